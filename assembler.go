@@ -2,92 +2,84 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
 type Assembler struct {
-	programNode ProgramNode
-	variables   []string
-	ifCount     int
-	fileSb      strings.Builder
+	programNode   ProgramNode
+	labelCount    int
+	fileSb        strings.Builder
+	diags         *Diagnostics
+	loops         []loopLabels
+	currentMethod *MethodNode
+	// literals are the string literals of the program, labelled by their
+	// index and emitted in the data section.
+	literals []string
 }
 
-func (a *Assembler) instrDeclareVariables(instNode InstNode) {
-	switch instNode.instType {
-	case INST_ASSIGN:
-		for _, variable := range a.variables {
-			if instNode.assignNode.identifier == variable {
-				return
-			}
-		}
-		a.variables = append(a.variables, instNode.assignNode.identifier)
-	case INST_IF:
-		a.relDeclareVariables(instNode.ifNode.relNode)
-		a.blockDeclareVariables(instNode.ifNode.ifBlockNode)
-	case INST_PRINT:
-		a.termDeclareVariables(instNode.printNode.termNode)
-	}
-}
+// argumentRegisters are the System V registers for the first six integer
+// arguments; any further arguments are passed on the stack.
+var argumentRegisters = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
 
-func (a *Assembler) blockDeclareVariables(blockNode BlockNode) {
-	for _, inst := range blockNode.instructions {
-		a.instrDeclareVariables(inst)
-	}
+// loopLabels are the labels that break and continue jump to inside a loop.
+type loopLabels struct {
+	breakLabel    string
+	continueLabel string
 }
 
-func (a *Assembler) exprDeclareVariables(exprNode ExprNode) {
-	switch exprNode.exprType {
-	case EXPR_TERM:
-		a.termDeclareVariables(exprNode.termNode)
-	case EXPR_PLUS:
-		a.termDeclareVariables(exprNode.termBinaryNode.lhs)
-		a.termDeclareVariables(exprNode.termBinaryNode.rhs)
+func newAssembler(programNode ProgramNode, diags *Diagnostics) Assembler {
+	return Assembler{
+		programNode: programNode,
+		fileSb:      strings.Builder{},
+		diags:       diags,
+		loops:       []loopLabels{},
 	}
 }
 
-func (a *Assembler) relDeclareVariables(relNode RelNode) {
-	switch relNode.relType {
-	case REL_LESS_THAN:
-		a.termDeclareVariables(relNode.termBinaryNode.lhs)
-		a.termDeclareVariables(relNode.termBinaryNode.rhs)
-	}
-}
-
-func (a *Assembler) termDeclareVariables(termNode TermNode) {
-	switch termNode.termType {
-	case TERM_INPUT:
-		break
-	case TERM_INT:
-		break
-	case TERM_IDENT:
-		// TODO: Add check for existing variable and panic
-		break
-	}
+// slot is the frame location of a resolved variable.
+func slot(symbol *Symbol) string {
+	return fmt.Sprintf("qword [rbp - %d]", symbol.slot*8+8)
 }
 
 func (a *Assembler) assembleProgram() {
-	for _, instNode := range a.programNode.instructions {
-		a.instrDeclareVariables(instNode)
-	}
-
 	a.fileSb.WriteString("LINE_MAX equ 1024\n")
 	a.fileSb.WriteString("%include \"string.inc\"\n")
 	a.fileSb.WriteString("%include \"util.inc\"\n")
+	a.fileSb.WriteString("%include \"array.inc\"\n")
 	a.fileSb.WriteString("SECTION .text\n")
 	a.fileSb.WriteString("global _start\n")
 	a.fileSb.WriteString("_start:\n")
 
 	a.fileSb.WriteString("mov rbp, rsp\n")
-	a.fileSb.WriteString(fmt.Sprintf("    sub rsp, %d\n", len(a.variables)*8))
+	a.fileSb.WriteString(fmt.Sprintf("    sub rsp, %d\n", a.programNode.locals*8))
 
-	for _, instNode := range a.programNode.instructions {
-		a.assembleInst(instNode)
-	}
+	a.assembleBlock(BlockNode{instructions: a.programNode.instructions})
 
-	a.fileSb.WriteString(fmt.Sprintf("    add rsp, %d\n", len(a.variables)*8))
+	a.fileSb.WriteString(fmt.Sprintf("    add rsp, %d\n", a.programNode.locals*8))
 
 	a.fileSb.WriteString("    exit_program 0\n")
 
+	for _, instNode := range a.programNode.instructions {
+		if instNode.instType == INST_METHOD {
+			a.assembleMethod(instNode.methodNode)
+		}
+	}
+
+	a.fileSb.WriteString("SECTION .data\n")
+	for i, literal := range a.literals {
+		a.fileSb.WriteString(fmt.Sprintf("str%d:\n", i))
+		a.fileSb.WriteString(fmt.Sprintf("    dq %d\n", len(literal)))
+		if len(literal) > 0 {
+			bytes := []string{}
+			for _, b := range []byte(literal) {
+				bytes = append(bytes, strconv.Itoa(int(b)))
+			}
+			a.fileSb.WriteString(fmt.Sprintf("    db %s\n", strings.Join(bytes, ",")))
+		}
+	}
+
 	a.fileSb.WriteString("SECTION .bss\n")
 	a.fileSb.WriteString("    line: resb LINE_MAX\n")
 }
@@ -95,13 +87,38 @@ func (a *Assembler) assembleProgram() {
 func (a *Assembler) assembleInst(instNode InstNode) {
 	switch instNode.instType {
 	case INST_ASSIGN:
-		a.assembleExpr(instNode.assignNode.expr)
-		index := a.findVariableIndex(instNode.assignNode.identifier)
-		a.fileSb.WriteString(fmt.Sprintf("    mov qword [rbp - %d], rax\n", index*8+8))
+		if instNode.assignNode.symbol.valueType.kind == TYPE_MAP {
+			a.diags.error(instNode.span, ERR_UNSUPPORTED, "maps are not supported by the nasm backend yet")
+			return
+		}
+		if instNode.assignNode.expr.exprType == "" {
+			a.assembleZeroValue(instNode.assignNode.symbol.valueType)
+		} else {
+			a.assembleExpr(instNode.assignNode.expr)
+		}
+		a.fileSb.WriteString(fmt.Sprintf("    mov %s, rax\n", slot(instNode.assignNode.symbol)))
+	case INST_REASSIGN:
+		reassignNode := instNode.reassignNode
+		if reassignNode.target.exprType == EXPR_MEMBER {
+			// Fields belong to classes, which were reported already.
+			return
+		}
+		// The address of the target is computed once, so that an index is
+		// only evaluated and checked once even for compound assignments.
+		a.assembleAddress(reassignNode.target)
+		a.fileSb.WriteString("    push rax\n")
+		a.assembleExpr(reassignNode.expr)
+		if reassignNode.operator != "" {
+			a.fileSb.WriteString("    mov rcx, rax\n")
+			a.fileSb.WriteString("    mov rax, qword [rsp]\n")
+			a.fileSb.WriteString("    mov rax, qword [rax]\n")
+			a.assembleOperator(reassignNode.operator, reassignNode.target.valueType, reassignNode.span)
+		}
+		a.fileSb.WriteString("    pop rcx\n")
+		a.fileSb.WriteString("    mov qword [rcx], rax\n")
 	case INST_IF:
-		a.assembleRel(instNode.ifNode.relNode)
-		label := a.ifCount
-		a.ifCount++
+		a.assembleExpr(instNode.ifNode.condNode)
+		label := a.nextLabel()
 		if len(instNode.ifNode.elseBlockNode.instructions) > 0 {
 			a.fileSb.WriteString("    test rax, rax\n")
 			a.fileSb.WriteString(fmt.Sprintf("    jz .else%d\n", label))
@@ -116,12 +133,267 @@ func (a *Assembler) assembleInst(instNode InstNode) {
 			a.assembleBlock(instNode.ifNode.ifBlockNode)
 			a.fileSb.WriteString(fmt.Sprintf(".endif%d:\n", label))
 		}
+	case INST_WHILE:
+		label := a.nextLabel()
+		a.fileSb.WriteString(fmt.Sprintf(".while%d:\n", label))
+		a.assembleExpr(instNode.whileNode.condNode)
+		a.fileSb.WriteString("    test rax, rax\n")
+		a.fileSb.WriteString(fmt.Sprintf("    jz .endwhile%d\n", label))
+		a.assembleLoopBlock(instNode.whileNode.blockNode, loopLabels{fmt.Sprintf(".endwhile%d", label), fmt.Sprintf(".while%d", label)})
+		a.fileSb.WriteString(fmt.Sprintf("    jmp .while%d\n", label))
+		a.fileSb.WriteString(fmt.Sprintf(".endwhile%d:\n", label))
+	case INST_FOR:
+		if instNode.forNode.arrayNode.exprType != "" {
+			a.assembleForArray(instNode.forNode)
+			return
+		}
+		// The end bound is evaluated once and kept on the stack for the
+		// duration of the loop.
+		label := a.nextLabel()
+		counter := slot(instNode.forNode.symbol)
+		a.assembleExpr(instNode.forNode.startNode)
+		a.fileSb.WriteString(fmt.Sprintf("    mov %s, rax\n", counter))
+		a.assembleExpr(instNode.forNode.endNode)
+		a.fileSb.WriteString("    push rax\n")
+		a.fileSb.WriteString(fmt.Sprintf(".for%d:\n", label))
+		a.fileSb.WriteString(fmt.Sprintf("    mov rax, %s\n", counter))
+		a.fileSb.WriteString("    cmp rax, qword [rsp]\n")
+		a.fileSb.WriteString(fmt.Sprintf("    jge .endfor%d\n", label))
+		a.assembleLoopBlock(instNode.forNode.blockNode, loopLabels{fmt.Sprintf(".endfor%d", label), fmt.Sprintf(".forstep%d", label)})
+		a.fileSb.WriteString(fmt.Sprintf(".forstep%d:\n", label))
+		a.fileSb.WriteString(fmt.Sprintf("    add %s, 1\n", counter))
+		a.fileSb.WriteString(fmt.Sprintf("    jmp .for%d\n", label))
+		a.fileSb.WriteString(fmt.Sprintf(".endfor%d:\n", label))
+		a.fileSb.WriteString("    add rsp, 8\n")
+	case INST_BREAK:
+		a.fileSb.WriteString(fmt.Sprintf("    jmp %s\n", a.loops[len(a.loops)-1].breakLabel))
+	case INST_CONTINUE:
+		a.fileSb.WriteString(fmt.Sprintf("    jmp %s\n", a.loops[len(a.loops)-1].continueLabel))
 	case INST_PRINT:
-		a.assembleTerm(instNode.printNode.termNode)
+		a.assemblePrint(instNode.printNode)
+	case INST_METHOD:
+		// Top level methods are emitted after the program itself.
+	case INST_CLASS:
+		a.diags.error(instNode.span, ERR_UNSUPPORTED, "classes are not supported by the nasm backend yet")
+	case INST_INTERFACE:
+		a.diags.error(instNode.span, ERR_UNSUPPORTED, "interfaces are not supported by the nasm backend yet")
+	case INST_RETURN:
+		a.assembleReturn(instNode.returnNode)
+	case INST_CALL:
+		a.assembleExpr(instNode.exprNode)
+	}
+}
+
+// assembleMethod emits a method as a System V function with its own frame.
+// Register arguments are spilled into the frame so every parameter lives in
+// a slot like any other variable.
+func (a *Assembler) assembleMethod(methodNode MethodNode) {
+	a.currentMethod = &methodNode
+	params := methodNode.parameters
+	frameSize := (methodNode.locals*8 + 15) / 16 * 16
+
+	a.fileSb.WriteString(fmt.Sprintf("method_%s:\n", methodNode.methodName))
+	a.fileSb.WriteString("    push rbp\n")
+	a.fileSb.WriteString("    mov rbp, rsp\n")
+	a.fileSb.WriteString(fmt.Sprintf("    sub rsp, %d\n", frameSize))
+	for i, paramNode := range params {
+		if i < len(argumentRegisters) {
+			a.fileSb.WriteString(fmt.Sprintf("    mov %s, %s\n", slot(paramNode.symbol), argumentRegisters[i]))
+		} else {
+			a.fileSb.WriteString(fmt.Sprintf("    mov rax, qword [rbp + %d]\n", 16+(i-len(argumentRegisters))*8))
+			a.fileSb.WriteString(fmt.Sprintf("    mov %s, rax\n", slot(paramNode.symbol)))
+		}
+	}
+
+	a.assembleBlock(methodNode.blockNode)
+
+	a.fileSb.WriteString(".method_return:\n")
+	a.fileSb.WriteString("    mov rsp, rbp\n")
+	a.fileSb.WriteString("    pop rbp\n")
+	a.fileSb.WriteString("    ret\n")
+	a.currentMethod = nil
+}
+
+func (a *Assembler) assembleReturn(returnNode ReturnNode) {
+	hasValue := returnNode.exprNode.exprType != ""
+	if a.currentMethod == nil {
+		// Returning from the top level exits the program with that status.
+		if hasValue {
+			a.assembleExpr(returnNode.exprNode)
+			a.fileSb.WriteString("    mov rdi, rax\n")
+			a.fileSb.WriteString("    mov rax, 60\n")
+			a.fileSb.WriteString("    syscall\n")
+		} else {
+			a.fileSb.WriteString("    exit_program 0\n")
+		}
+		return
+	}
+	if hasValue {
+		a.assembleExpr(returnNode.exprNode)
+	}
+	a.fileSb.WriteString("    jmp .method_return\n")
+}
+
+// assembleCall reserves a stack slot per argument and evaluates the
+// arguments left to right into them, the first at the top, as the other
+// backends do. The first six are then popped into their registers, the rest
+// stay on the stack in order, and the result is left in rax.
+func (a *Assembler) assembleCall(callNode CallNode) {
+	switch callNode.symbol.kind {
+	case SYMBOL_BUILTIN:
+		a.assembleBuiltin(callNode)
+		return
+	case SYMBOL_CLASS:
+		return
+	}
+	arguments, _ := callNode.symbol.methodNode.bindArguments(callNode.arguments)
+	if len(arguments) > 0 {
+		a.fileSb.WriteString(fmt.Sprintf("    sub rsp, %d\n", len(arguments)*8))
+	}
+	for i, argument := range arguments {
+		a.assembleExpr(argument)
+		a.fileSb.WriteString(fmt.Sprintf("    mov qword [rsp + %d], rax\n", i*8))
+	}
+	for i := 0; i < min(len(arguments), len(argumentRegisters)); i++ {
+		a.fileSb.WriteString(fmt.Sprintf("    pop %s\n", argumentRegisters[i]))
+	}
+	a.fileSb.WriteString(fmt.Sprintf("    call method_%s\n", callNode.methodName))
+	if len(arguments) > len(argumentRegisters) {
+		a.fileSb.WriteString(fmt.Sprintf("    add rsp, %d\n", (len(arguments)-len(argumentRegisters))*8))
+	}
+}
+
+// assembleForArray runs a loop over the elements of an array. The array and
+// the index of the current element are kept on the stack for the duration
+// of the loop, and the length is read again on every iteration since the
+// body may push to the array.
+func (a *Assembler) assembleForArray(forNode ForNode) {
+	label := a.nextLabel()
+	a.assembleExpr(forNode.arrayNode)
+	a.fileSb.WriteString("    push rax\n")
+	a.fileSb.WriteString("    push qword 0\n")
+	a.fileSb.WriteString(fmt.Sprintf(".for%d:\n", label))
+	a.fileSb.WriteString("    mov rax, qword [rsp]\n")
+	a.fileSb.WriteString("    mov rcx, qword [rsp + 8]\n")
+	a.fileSb.WriteString("    cmp rax, qword [rcx]\n")
+	a.fileSb.WriteString(fmt.Sprintf("    jge .endfor%d\n", label))
+	a.fileSb.WriteString("    mov rcx, qword [rcx + 16]\n")
+	a.fileSb.WriteString("    mov rax, qword [rcx + rax*8]\n")
+	a.fileSb.WriteString(fmt.Sprintf("    mov %s, rax\n", slot(forNode.symbol)))
+	a.assembleLoopBlock(forNode.blockNode, loopLabels{fmt.Sprintf(".endfor%d", label), fmt.Sprintf(".forstep%d", label)})
+	a.fileSb.WriteString(fmt.Sprintf(".forstep%d:\n", label))
+	a.fileSb.WriteString("    add qword [rsp], 1\n")
+	a.fileSb.WriteString(fmt.Sprintf("    jmp .for%d\n", label))
+	a.fileSb.WriteString(fmt.Sprintf(".endfor%d:\n", label))
+	a.fileSb.WriteString("    add rsp, 16\n")
+}
+
+func (a *Assembler) assembleBuiltin(callNode CallNode) {
+	switch callNode.methodName {
+	case "len":
+		// Strings and arrays both start with their length.
+		a.assembleExpr(callNode.arguments[0])
+		a.fileSb.WriteString("    mov rax, qword [rax]\n")
+	case "push":
+		a.assembleExpr(callNode.arguments[0])
+		a.fileSb.WriteString("    push rax\n")
+		a.assembleExpr(callNode.arguments[1])
+		a.fileSb.WriteString("    mov rsi, rax\n")
+		a.fileSb.WriteString("    pop rdi\n")
+		a.fileSb.WriteString("    call array_push\n")
+	}
+}
+
+// assembleAddress leaves the address of the variable or array element an
+// assignable expression names in rax.
+func (a *Assembler) assembleAddress(exprNode ExprNode) {
+	if exprNode.exprType != EXPR_INDEX {
+		a.fileSb.WriteString(fmt.Sprintf("    lea rax, [rbp - %d]\n", exprNode.termNode.symbol.slot*8+8))
+		return
+	}
+	a.assembleExpr(*exprNode.indexNode.array)
+	a.fileSb.WriteString("    push rax\n")
+	a.assembleExpr(*exprNode.indexNode.index)
+	a.fileSb.WriteString("    mov rsi, rax\n")
+	a.fileSb.WriteString("    pop rdi\n")
+	a.fileSb.WriteString(fmt.Sprintf("    mov rdx, %s\n", a.location(exprNode.span)))
+	a.fileSb.WriteString("    call array_check\n")
+	a.fileSb.WriteString("    mov rax, qword [rdi + 16]\n")
+	a.fileSb.WriteString("    lea rax, [rax + rsi*8]\n")
+}
+
+// assembleArray allocates the array of a literal and fills in its elements.
+func (a *Assembler) assembleArray(exprNode ExprNode) {
+	elements := exprNode.termNode.elements
+	a.fileSb.WriteString(fmt.Sprintf("    mov rdi, %d\n", len(elements)))
+	a.fileSb.WriteString("    call array_new\n")
+	a.fileSb.WriteString("    push rax\n")
+	for i, element := range elements {
+		a.assembleExpr(element)
+		a.fileSb.WriteString("    mov rcx, qword [rsp]\n")
+		a.fileSb.WriteString("    mov rcx, qword [rcx + 16]\n")
+		a.fileSb.WriteString(fmt.Sprintf("    mov qword [rcx + %d], rax\n", i*8))
+	}
+	a.fileSb.WriteString("    pop rax\n")
+}
+
+// assembleZeroValue leaves the value of a variable declared without one in
+// rax. An array is never null: it gets a header of its own, empty when it
+// grows and of its full length when it is fixed, and every element of a
+// fixed array of arrays gets an array of its own.
+func (a *Assembler) assembleZeroValue(t *Type) {
+	if t.kind == TYPE_STRING {
+		a.fileSb.WriteString(fmt.Sprintf("    mov rax, %s\n", a.literal("")))
+		return
+	}
+	if t.kind != TYPE_ARRAY {
+		a.fileSb.WriteString("    xor rax, rax\n")
+		return
+	}
+	length := max(t.length, 0)
+	a.fileSb.WriteString(fmt.Sprintf("    mov rdi, %d\n", length))
+	a.fileSb.WriteString("    call array_new\n")
+	if t.elem.kind != TYPE_ARRAY || length == 0 {
+		return
+	}
+	label := a.nextLabel()
+	a.fileSb.WriteString("    push rax\n")
+	a.fileSb.WriteString("    push qword 0\n")
+	a.fileSb.WriteString(fmt.Sprintf(".zero%d:\n", label))
+	a.fileSb.WriteString(fmt.Sprintf("    cmp qword [rsp], %d\n", length))
+	a.fileSb.WriteString(fmt.Sprintf("    jge .endzero%d\n", label))
+	a.assembleZeroValue(t.elem)
+	a.fileSb.WriteString("    mov rcx, qword [rsp + 8]\n")
+	a.fileSb.WriteString("    mov rcx, qword [rcx + 16]\n")
+	a.fileSb.WriteString("    mov rdx, qword [rsp]\n")
+	a.fileSb.WriteString("    mov qword [rcx + rdx*8], rax\n")
+	a.fileSb.WriteString("    add qword [rsp], 1\n")
+	a.fileSb.WriteString(fmt.Sprintf("    jmp .zero%d\n", label))
+	a.fileSb.WriteString(fmt.Sprintf(".endzero%d:\n", label))
+	a.fileSb.WriteString("    add rsp, 8\n")
+	a.fileSb.WriteString("    pop rax\n")
+}
+
+// assemblePrint writes a value and a newline to stdout with the runtime
+// routine for its type.
+func (a *Assembler) assemblePrint(printNode PrintNode) {
+	a.assembleExpr(printNode.exprNode)
+	switch printNode.exprNode.valueType.kind {
+	case TYPE_BOOL:
+		a.fileSb.WriteString("    mov rdi, 1\n")
+		a.fileSb.WriteString("    mov rsi, rax\n")
+		a.fileSb.WriteString("    call write_bool\n")
+	case TYPE_STRING:
 		a.fileSb.WriteString("    mov rdi, 1\n")
 		a.fileSb.WriteString("    mov rsi, rax\n")
-		a.fileSb.WriteString("    call write_uint\n")
+		a.fileSb.WriteString("    call write_string\n")
+	default:
+		a.fileSb.WriteString("    mov rdi, 1\n")
+		a.fileSb.WriteString("    mov rsi, rax\n")
+		a.fileSb.WriteString("    call write_int\n")
 	}
+	a.fileSb.WriteString("    mov rdi, 1\n")
+	a.fileSb.WriteString("    call write_newline\n")
 }
 
 func (a *Assembler) assembleBlock(blockNode BlockNode) {
@@ -130,53 +402,183 @@ func (a *Assembler) assembleBlock(blockNode BlockNode) {
 	}
 }
 
+func (a *Assembler) assembleLoopBlock(blockNode BlockNode, labels loopLabels) {
+	a.loops = append(a.loops, labels)
+	a.assembleBlock(blockNode)
+	a.loops = a.loops[:len(a.loops)-1]
+}
+
 func (a *Assembler) assembleExpr(exprNode ExprNode) {
 	switch exprNode.exprType {
 	case EXPR_TERM:
+		if exprNode.isArrayLiteral() {
+			a.assembleArray(exprNode)
+			return
+		}
+		if exprNode.isMapLiteral() {
+			a.diags.error(exprNode.span, ERR_UNSUPPORTED, "maps are not supported by the nasm backend yet")
+			return
+		}
 		a.assembleTerm(exprNode.termNode)
+		return
+	case EXPR_NEGATE:
+		a.assembleExpr(*exprNode.exprUnaryNode.operand)
+		a.fileSb.WriteString("    neg rax\n")
+		a.fileSb.WriteString("    movsxd rax, eax\n")
+		return
+	case EXPR_NOT:
+		a.assembleExpr(*exprNode.exprUnaryNode.operand)
+		a.fileSb.WriteString("    test rax, rax\n")
+		a.fileSb.WriteString("    sete al\n")
+		a.fileSb.WriteString("    movzx rax, al\n")
+		return
+	case EXPR_AND, EXPR_OR:
+		a.assembleLogical(exprNode)
+		return
+	case EXPR_MEMBER, EXPR_MEMBER_CALL:
+		// Objects only come from classes, which were reported already.
+		return
+	case EXPR_INDEX:
+		a.assembleAddress(exprNode)
+		a.fileSb.WriteString("    mov rax, qword [rax]\n")
+		return
+	}
+
+	// Operands are evaluated left to right with the left one parked on the
+	// stack, so arbitrarily nested expressions only need rax and rcx.
+	a.assembleExpr(*exprNode.exprBinaryNode.lhs)
+	a.fileSb.WriteString("    push rax\n")
+	a.assembleExpr(*exprNode.exprBinaryNode.rhs)
+	a.fileSb.WriteString("    mov rcx, rax\n")
+	a.fileSb.WriteString("    pop rax\n")
+	a.assembleOperator(exprNode.exprType, exprNode.exprBinaryNode.lhs.valueType, exprNode.span)
+}
+
+// assembleOperator applies a binary operator to the operands in rax and rcx,
+// whose type is operandType, leaving the result in rax. Ints are kept sign
+// extended from 32 bits, so arithmetic wraps around as in the other
+// backends. A division without an int result stops the program with an
+// error pointing at span.
+func (a *Assembler) assembleOperator(exprType ExprType, operandType *Type, span Span) {
+	if operandType.kind == TYPE_STRING {
+		a.assembleStringOperator(exprType)
+		return
+	}
+	switch exprType {
+	case EXPR_PLUS:
+		a.fileSb.WriteString("    add rax, rcx\n")
+		a.fileSb.WriteString("    movsxd rax, eax\n")
+	case EXPR_MINUS:
+		a.fileSb.WriteString("    sub rax, rcx\n")
+		a.fileSb.WriteString("    movsxd rax, eax\n")
+	case EXPR_MULTIPLY:
+		a.fileSb.WriteString("    imul rax, rcx\n")
+		a.fileSb.WriteString("    movsxd rax, eax\n")
+	case EXPR_DIVIDE, EXPR_MODULO:
+		a.fileSb.WriteString(fmt.Sprintf("    mov rdx, %s\n", a.location(span)))
+		a.fileSb.WriteString("    call divide_check\n")
+		a.fileSb.WriteString("    cqo\n")
+		a.fileSb.WriteString("    idiv rcx\n")
+		if exprType == EXPR_MODULO {
+			a.fileSb.WriteString("    mov rax, rdx\n")
+		}
+	default:
+		a.fileSb.WriteString("    cmp rax, rcx\n")
+		a.fileSb.WriteString(fmt.Sprintf("    %s al\n", comparisonSetInstructions[exprType]))
+		a.fileSb.WriteString("    movzx rax, al\n")
+	}
+}
+
+// assembleStringOperator applies + or an equality test to the strings in
+// rax and rcx.
+func (a *Assembler) assembleStringOperator(exprType ExprType) {
+	a.fileSb.WriteString("    mov rdi, rax\n")
+	a.fileSb.WriteString("    mov rsi, rcx\n")
+	switch exprType {
 	case EXPR_PLUS:
-		a.assembleTerm(exprNode.termBinaryNode.lhs)
-		a.fileSb.WriteString("    mov rdx, rax\n")
-		a.assembleTerm(exprNode.termBinaryNode.rhs)
-		a.fileSb.WriteString("    add rax, rdx\n")
+		a.fileSb.WriteString("    call string_concat\n")
+	case EXPR_EQUAL:
+		a.fileSb.WriteString("    call string_equal\n")
+	case EXPR_NOT_EQUAL:
+		a.fileSb.WriteString("    call string_equal\n")
+		a.fileSb.WriteString("    xor rax, 1\n")
 	}
 }
 
+var comparisonSetInstructions = map[ExprType]string{
+	EXPR_LESS_THAN:          "setl",
+	EXPR_GREATER_THAN:       "setg",
+	EXPR_LESS_THAN_EQUAL:    "setle",
+	EXPR_GREATER_THAN_EQUAL: "setge",
+	EXPR_EQUAL:              "sete",
+	EXPR_NOT_EQUAL:          "setne",
+}
+
+// assembleLogical evaluates the right operand of && and || only when the
+// left one does not already decide the result, leaving 0 or 1 in rax.
+func (a *Assembler) assembleLogical(exprNode ExprNode) {
+	label := a.nextLabel()
+	jump := "jz"
+	if exprNode.exprType == EXPR_OR {
+		jump = "jnz"
+	}
+	a.assembleExpr(*exprNode.exprBinaryNode.lhs)
+	a.fileSb.WriteString("    test rax, rax\n")
+	a.fileSb.WriteString(fmt.Sprintf("    %s .logic%d\n", jump, label))
+	a.assembleExpr(*exprNode.exprBinaryNode.rhs)
+	a.fileSb.WriteString("    test rax, rax\n")
+	a.fileSb.WriteString(fmt.Sprintf(".logic%d:\n", label))
+	a.fileSb.WriteString("    setnz al\n")
+	a.fileSb.WriteString("    movzx rax, al\n")
+}
+
 func (a *Assembler) assembleTerm(termNode TermNode) {
 	switch termNode.termType {
 	case TERM_INPUT:
-		a.fileSb.WriteString("    read 0, line, LINE_MAX\n")
-		a.fileSb.WriteString("    mov rdi, line\n")
-		a.fileSb.WriteString("    call strlen\n")
+		if termNode.value == "string" {
+			a.fileSb.WriteString("    call read_string\n")
+			return
+		}
+		a.fileSb.WriteString("    call read_line\n")
 		a.fileSb.WriteString("    mov rdi, line\n")
 		a.fileSb.WriteString("    mov rsi, rax\n")
-		a.fileSb.WriteString("    call parse_uint\n")
+		a.fileSb.WriteString("    call parse_int\n")
 	case TERM_INT:
 		a.fileSb.WriteString(fmt.Sprintf("    mov rax, %s\n", termNode.value))
+	case TERM_STRING:
+		a.fileSb.WriteString(fmt.Sprintf("    mov rax, %s\n", a.literal(termNode.value)))
+	case TERM_BOOL:
+		if termNode.value == "true" {
+			a.fileSb.WriteString("    mov rax, 1\n")
+		} else {
+			a.fileSb.WriteString("    xor rax, rax\n")
+		}
 	case TERM_IDENT:
-		index := a.findVariableIndex(termNode.value)
-		a.fileSb.WriteString(fmt.Sprintf("    mov rax, qword [rbp - %d]\n", index*8+8))
+		a.fileSb.WriteString(fmt.Sprintf("    mov rax, %s\n", slot(termNode.symbol)))
+	case TERM_CALL:
+		a.assembleCall(termNode.callNode)
 	}
 }
 
-func (a *Assembler) assembleRel(relNode RelNode) {
-	switch relNode.relType {
-	case REL_LESS_THAN:
-		a.assembleTerm(relNode.termBinaryNode.lhs)
-		a.fileSb.WriteString("    mov rdx, rax\n")
-		a.assembleTerm(relNode.termBinaryNode.rhs)
-		a.fileSb.WriteString("    cmp rdx, rax\n")
-		a.fileSb.WriteString("    setl al\n")
-		a.fileSb.WriteString("    and al, 1\n")
-		a.fileSb.WriteString("    movzx rax, al\n")
+// literal returns the label of a string literal in the data section. Equal
+// literals share a label.
+func (a *Assembler) literal(s string) string {
+	index := slices.Index(a.literals, s)
+	if index < 0 {
+		index = len(a.literals)
+		a.literals = append(a.literals, s)
 	}
+	return fmt.Sprintf("str%d", index)
 }
 
-func (a *Assembler) findVariableIndex(variable string) int {
-	for i, varble := range a.variables {
-		if varble == variable {
-			return i
-		}
-	}
-	return -1
+// location returns the label of a string naming where span starts, for
+// runtime errors.
+func (a *Assembler) location(span Span) string {
+	return a.literal(fmt.Sprintf("%s:%s", a.programNode.fileName, span.start))
+}
+
+func (a *Assembler) nextLabel() int {
+	label := a.labelCount
+	a.labelCount++
+	return label
 }
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type AstFormat string
+
+const (
+	AST_TREE  AstFormat = "tree"
+	AST_SEXPR AstFormat = "sexpr"
+	AST_JSON  AstFormat = "json"
+)
+
+// AstNode is a node of the syntax tree as yeol ast shows it. kind is the
+// type of the node, such as INST_ASSIGN or TERM_INT, and fields are its
+// values in a fixed order. Terms stand for themselves, without the
+// EXPR_TERM node around them.
+type AstNode struct {
+	kind     string
+	fields   []AstField
+	span     Span
+	children []AstNode
+	// label replaces the fields on the line of the node in the indented
+	// tree. It is empty when the fields, separated by spaces, read well.
+	label string
+}
+
+// AstField is a value of a node. value is a string, or a []string for a
+// list such as the supertypes of a class.
+type AstField struct {
+	name  string
+	value any
+}
+
+func newAstNode(kind string, span Span, fields ...AstField) AstNode {
+	node := AstNode{kind: kind, span: span}
+	// Fields with no value, such as the type of a variable that is
+	// inferred, are left out.
+	for _, field := range fields {
+		if field.value != "" && field.value != nil {
+			node.fields = append(node.fields, field)
+		}
+	}
+	return node
+}
+
+func (n *AstNode) add(children ...AstNode) {
+	n.children = append(n.children, children...)
+}
+
+func programAst(programNode ProgramNode) AstNode {
+	node := newAstNode("PROGRAM", programNode.span, AstField{"file", programNode.fileName})
+	for _, instNode := range programNode.instructions {
+		node.add(instAst(instNode))
+	}
+	return node
+}
+
+func blockAst(blockNode BlockNode) AstNode {
+	node := newAstNode("BLOCK", blockNode.span)
+	for _, instNode := range blockNode.instructions {
+		node.add(instAst(instNode))
+	}
+	return node
+}
+
+func instAst(instNode InstNode) AstNode {
+	kind := string(instNode.instType)
+	var node AstNode
+	switch instNode.instType {
+	case INST_ASSIGN:
+		assignNode := instNode.assignNode
+		node = newAstNode(kind, instNode.span, AstField{"type", assignNode.typeName}, AstField{"name", assignNode.identifier})
+		if assignNode.expr.exprType != "" {
+			node.add(exprAst(assignNode.expr))
+		}
+	case INST_REASSIGN:
+		reassignNode := instNode.reassignNode
+		operator := "="
+		if reassignNode.operator != "" {
+			operator = reassignNode.operator.spelling() + "="
+		}
+		node = newAstNode(kind, instNode.span, AstField{"operator", operator})
+		node.add(exprAst(reassignNode.target), exprAst(reassignNode.expr))
+	case INST_IF:
+		ifNode := instNode.ifNode
+		node = newAstNode(kind, instNode.span)
+		node.add(exprAst(ifNode.condNode), blockAst(ifNode.ifBlockNode))
+		if ifNode.elseBlockNode.span != (Span{}) {
+			node.add(blockAst(ifNode.elseBlockNode))
+		}
+	case INST_WHILE:
+		node = newAstNode(kind, instNode.span)
+		node.add(exprAst(instNode.whileNode.condNode), blockAst(instNode.whileNode.blockNode))
+	case INST_FOR:
+		forNode := instNode.forNode
+		node = newAstNode(kind, instNode.span, AstField{"name", forNode.identifier})
+		if forNode.arrayNode.exprType != "" {
+			node.add(exprAst(forNode.arrayNode))
+		} else {
+			node.add(exprAst(forNode.startNode), exprAst(forNode.endNode))
+		}
+		node.add(blockAst(forNode.blockNode))
+	case INST_PRINT:
+		node = newAstNode(kind, instNode.span)
+		node.add(exprAst(instNode.printNode.exprNode))
+	case INST_RETURN:
+		node = newAstNode(kind, instNode.span)
+		if instNode.returnNode.exprNode.exprType != "" {
+			node.add(exprAst(instNode.returnNode.exprNode))
+		}
+	case INST_CALL:
+		node = newAstNode(kind, instNode.span)
+		node.add(exprAst(instNode.exprNode))
+	case INST_METHOD:
+		node = methodAst(instNode.methodNode)
+	case INST_CLASS:
+		classNode := instNode.classNode
+		var supertypes any
+		if len(classNode.supertypes) > 0 {
+			supertypes = classNode.supertypes
+		}
+		node = newAstNode(kind, instNode.span, AstField{"name", classNode.className}, AstField{"supertypes", supertypes})
+		if supertypes != nil {
+			node.label = classNode.className + ": " + strings.Join(classNode.supertypes, ", ")
+		}
+		for _, fieldNode := range classNode.fields {
+			field := newAstNode("FIELD", fieldNode.span, AstField{"type", fieldNode.typeName}, AstField{"name", fieldNode.name})
+			if fieldNode.initializer != nil {
+				field.add(exprAst(*fieldNode.initializer))
+			}
+			node.add(field)
+		}
+		for _, methodNode := range classNode.methods {
+			node.add(methodAst(methodNode))
+		}
+	case INST_INTERFACE:
+		node = newAstNode(kind, instNode.span, AstField{"name", instNode.interfaceNode.name})
+		for _, methodNode := range instNode.interfaceNode.methods {
+			node.add(signatureAst(methodNode))
+		}
+	default:
+		node = newAstNode(kind, instNode.span)
+	}
+	return node
+}
+
+func methodAst(methodNode MethodNode) AstNode {
+	node := signatureAst(methodNode)
+	node.add(blockAst(methodNode.blockNode))
+	return node
+}
+
+// signatureAst is a method with its parameters as children. Default values
+// are children of their parameter.
+func signatureAst(methodNode MethodNode) AstNode {
+	node := newAstNode(string(INST_METHOD), methodNode.span, AstField{"name", methodNode.methodName}, AstField{"returns", methodNode.returnType})
+	node.label = methodNode.methodName + ": " + methodNode.returnType
+	for _, paramNode := range methodNode.parameters {
+		param := newAstNode("PARAM", paramNode.span, AstField{"name", paramNode.name}, AstField{"type", paramNode.typeName})
+		param.label = paramNode.name + ": " + paramNode.typeName
+		if paramNode.defaultValue != nil {
+			param.add(exprAst(*paramNode.defaultValue))
+		}
+		node.add(param)
+	}
+	return node
+}
+
+func exprAst(exprNode ExprNode) AstNode {
+	kind := string(exprNode.exprType)
+	switch exprNode.exprType {
+	case EXPR_TERM:
+		return termAst(exprNode.termNode, exprNode.span)
+	case EXPR_NEGATE, EXPR_NOT:
+		node := newAstNode(kind, exprNode.span)
+		node.add(exprAst(*exprNode.exprUnaryNode.operand))
+		return node
+	case EXPR_MEMBER, EXPR_MEMBER_CALL:
+		memberNode := exprNode.memberNode
+		node := newAstNode(kind, exprNode.span, AstField{"name", memberNode.name})
+		node.add(exprAst(*memberNode.object))
+		for _, argument := range memberNode.callNode.arguments {
+			node.add(exprAst(argument))
+		}
+		return node
+	case EXPR_INDEX:
+		node := newAstNode(kind, exprNode.span)
+		node.add(exprAst(*exprNode.indexNode.array), exprAst(*exprNode.indexNode.index))
+		return node
+	}
+	node := newAstNode(kind, exprNode.span)
+	node.add(exprAst(*exprNode.exprBinaryNode.lhs), exprAst(*exprNode.exprBinaryNode.rhs))
+	return node
+}
+
+// termAst is a term spanning span. Each entry of a map literal is an ENTRY
+// node with the key and the value as children.
+func termAst(termNode TermNode, span Span) AstNode {
+	kind := string(termNode.termType)
+	switch termNode.termType {
+	case TERM_INPUT:
+		return newAstNode(kind, span, AstField{"type", termNode.value})
+	case TERM_IDENT:
+		return newAstNode(kind, span, AstField{"name", termNode.value})
+	case TERM_STRING:
+		// An empty string is a value too, so it is not left out.
+		node := newAstNode(kind, span)
+		node.fields = []AstField{{"value", termNode.value}}
+		node.label = strconv.Quote(termNode.value)
+		return node
+	case TERM_CALL:
+		node := newAstNode(kind, span, AstField{"name", termNode.callNode.methodName})
+		for _, argument := range termNode.callNode.arguments {
+			node.add(exprAst(argument))
+		}
+		return node
+	case TERM_ARRAY:
+		node := newAstNode(kind, span)
+		for _, element := range termNode.elements {
+			node.add(exprAst(element))
+		}
+		return node
+	case TERM_MAP:
+		node := newAstNode(kind, span)
+		for n := range termNode.elements {
+			entry := newAstNode("ENTRY", spanBetween(termNode.elements[n].span, termNode.values[n].span))
+			entry.add(exprAst(termNode.elements[n]), exprAst(termNode.values[n]))
+			node.add(entry)
+		}
+		return node
+	}
+	return newAstNode(kind, span, AstField{"value", termNode.value})
+}
+
+// formatAstTree writes one node per line, with the children of a node
+// indented below it.
+func formatAstTree(node AstNode) string {
+	var sb strings.Builder
+	var write func(node AstNode, depth int)
+	write = func(node AstNode, depth int) {
+		sb.WriteString(strings.Repeat("  ", depth))
+		sb.WriteString(node.kind)
+		label := node.label
+		if label == "" {
+			values := []string{}
+			for _, field := range node.fields {
+				values = append(values, fmt.Sprint(field.value))
+			}
+			label = strings.Join(values, " ")
+		}
+		if label = strings.TrimSpace(label); label != "" {
+			sb.WriteString(" " + label)
+		}
+		sb.WriteString("\n")
+		for _, child := range node.children {
+			write(child, depth+1)
+		}
+	}
+	write(node, 0)
+	return sb.String()
+}
+
+// formatAstSexpr writes a node as an S-expression. Fields are written as
+// keywords followed by their value, and children start on lines of their
+// own.
+func formatAstSexpr(node AstNode) string {
+	var sb strings.Builder
+	var write func(node AstNode, depth int)
+	write = func(node AstNode, depth int) {
+		sb.WriteString("(" + node.kind)
+		for _, field := range node.fields {
+			sb.WriteString(" :" + field.name + " ")
+			if values, ok := field.value.([]string); ok {
+				atoms := make([]string, len(values))
+				for n, value := range values {
+					atoms[n] = sexprAtom(value)
+				}
+				sb.WriteString("(" + strings.Join(atoms, " ") + ")")
+			} else if node.kind == string(TERM_STRING) {
+				// String literals stay strings even when they look like
+				// names.
+				sb.WriteString(strconv.Quote(field.value.(string)))
+			} else {
+				sb.WriteString(sexprAtom(field.value.(string)))
+			}
+		}
+		for _, child := range node.children {
+			sb.WriteString("\n" + strings.Repeat("  ", depth+1))
+			write(child, depth+1)
+		}
+		sb.WriteString(")")
+	}
+	write(node, 0)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// sexprAtom writes a value as a bare symbol when it is a name or a number,
+// and as a quoted string otherwise.
+func sexprAtom(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for n := 0; n < len(value); n++ {
+		if !isLetter(value[n]) && (value[n] < '0' || value[n] > '9') {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+type jsonPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonSpan struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonAstNode struct {
+	Kind     string         `json:"kind"`
+	Fields   map[string]any `json:"fields"`
+	Span     jsonSpan       `json:"span"`
+	Children []jsonAstNode  `json:"children"`
+}
+
+func newJsonPosition(p Position) jsonPosition {
+	return jsonPosition{p.offset, p.line, p.column}
+}
+
+func newJsonAstNode(node AstNode) jsonAstNode {
+	j := jsonAstNode{
+		Kind:     node.kind,
+		Fields:   map[string]any{},
+		Span:     jsonSpan{newJsonPosition(node.span.start), newJsonPosition(node.span.end)},
+		Children: []jsonAstNode{},
+	}
+	for _, field := range node.fields {
+		j.Fields[field.name] = field.value
+	}
+	for _, child := range node.children {
+		j.Children = append(j.Children, newJsonAstNode(child))
+	}
+	return j
+}
+
+// formatAstJson writes a node as indented JSON. Every node has the same
+// keys, and fields are sorted by name, so the same tree always comes out
+// the same way. Offsets count bytes from the start of the file; lines and
+// columns start at 1.
+func formatAstJson(node AstNode) (string, error) {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(newJsonAstNode(node)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// formatProgramAst writes the syntax tree of a program in format.
+func formatProgramAst(programNode ProgramNode, format AstFormat) (string, error) {
+	node := programAst(programNode)
+	switch format {
+	case AST_SEXPR:
+		return formatAstSexpr(node), nil
+	case AST_JSON:
+		return formatAstJson(node)
+	}
+	return formatAstTree(node), nil
+}
+
+func formatProgramTree(programNode ProgramNode) string {
+	return formatAstTree(programAst(programNode))
+}
+
+func formatExprTree(exprNode ExprNode) string {
+	return formatAstTree(exprAst(exprNode))
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Checker infers the type of every expression and verifies it against the
+// declarations it flows into. It runs after the resolver, so every name in
+// the tree already has a symbol, and leaves the types on the AST for the
+// backends.
+type Checker struct {
+	diags  *Diagnostics
+	method *MethodNode
+	// userTypes holds the classes and interfaces of the program by name.
+	userTypes map[string]*Type
+}
+
+func newChecker(diags *Diagnostics) Checker {
+	return Checker{diags, nil, make(map[string]*Type)}
+}
+
+func (c *Checker) checkProgram(programNode *ProgramNode) {
+	c.declareTypes(programNode.instructions)
+	c.declareMethods(programNode.instructions)
+	c.declareFields(programNode.instructions)
+	c.checkInstructions(programNode.instructions)
+}
+
+// declareTypes makes the class and interface names usable as types.
+func (c *Checker) declareTypes(instructions []InstNode) {
+	for i := range instructions {
+		var t *Type
+		switch instructions[i].instType {
+		case INST_CLASS:
+			classNode := &instructions[i].classNode
+			t = &Type{kind: TYPE_CLASS, name: classNode.className, classNode: classNode}
+		case INST_INTERFACE:
+			interfaceNode := &instructions[i].interfaceNode
+			t = &Type{kind: TYPE_INTERFACE, name: interfaceNode.name, interfaceNode: interfaceNode}
+		default:
+			continue
+		}
+		if _, ok := primitiveTypes[t.name]; ok {
+			c.diags.error(instructions[i].span, ERR_REDECLARED, "`%s` is a built-in type", t.name)
+		}
+		c.userTypes[t.name] = t
+	}
+}
+
+// declareMethods gives the methods of a block, and those of its classes,
+// their signatures up front so that calls can be checked before the method
+// body has been seen.
+func (c *Checker) declareMethods(instructions []InstNode) {
+	for i := range instructions {
+		switch instructions[i].instType {
+		case INST_METHOD:
+			c.declareMethod(&instructions[i].methodNode)
+		case INST_CLASS:
+			classNode := &instructions[i].classNode
+			for j := range classNode.methods {
+				methodNode := &classNode.methods[j]
+				c.declareMethod(methodNode)
+				methodNode.self.valueType = c.userTypes[classNode.className]
+				if methodNode.methodName == "init" && methodNode.symbol.valueType.kind != TYPE_VOID {
+					c.diags.error(methodNode.span, ERR_TYPE_MISMATCH, "`init` of class `%s` cannot return a value", classNode.className)
+				}
+			}
+		case INST_INTERFACE:
+			interfaceNode := &instructions[i].interfaceNode
+			for j := range interfaceNode.methods {
+				c.declareMethod(&interfaceNode.methods[j])
+			}
+		}
+	}
+	for i := range instructions {
+		if instructions[i].instType != INST_CLASS {
+			continue
+		}
+		classNode := &instructions[i].classNode
+		for j := range classNode.methods {
+			methodNode := &classNode.methods[j]
+			if methodNode.overrides != nil {
+				base := methodNode.overrides.methodNode
+				c.matchSignature(methodNode, base, ERR_BAD_OVERRIDE, fmt.Sprintf("the overridden `%s`", base.qualifiedName()))
+			}
+		}
+		for _, interfaceNode := range classNode.interfaces {
+			c.checkConformance(classNode, interfaceNode)
+		}
+	}
+}
+
+// checkConformance verifies that a class has every method of an interface it
+// claims to implement, inherited methods included.
+func (c *Checker) checkConformance(classNode *ClassNode, interfaceNode *InterfaceNode) {
+	for i := range interfaceNode.methods {
+		required := &interfaceNode.methods[i]
+		symbol := classNode.members[required.methodName]
+		if symbol == nil || symbol.kind != SYMBOL_METHOD {
+			c.diags.error(classNode.span, ERR_NOT_CONFORMING, "class `%s` does not implement `%s` of interface `%s`", classNode.className, required.methodName, interfaceNode.name)
+			continue
+		}
+		c.matchSignature(symbol.methodNode, required, ERR_NOT_CONFORMING, fmt.Sprintf("`%s`", required.qualifiedName()))
+	}
+}
+
+// matchSignature verifies that a method has the same parameter and return
+// types as the method want, so that it can be called in its place.
+func (c *Checker) matchSignature(methodNode *MethodNode, want *MethodNode, code string, wanted string) {
+	if len(methodNode.parameters) != len(want.parameters) {
+		c.diags.error(methodNode.span, code, "`%s` takes %d parameter(s) but %s takes %d", methodNode.qualifiedName(), len(methodNode.parameters), wanted, len(want.parameters))
+		return
+	}
+	for i, paramNode := range methodNode.parameters {
+		wantType := want.parameters[i].symbol.valueType
+		if got := paramNode.symbol.valueType; !got.equals(wantType) || !wantType.equals(got) {
+			c.diags.error(paramNode.span, code, "parameter `%s` of `%s` has type %s but %s takes %s", paramNode.name, methodNode.qualifiedName(), got, wanted, wantType)
+		}
+	}
+	if got, wantType := methodNode.symbol.valueType, want.symbol.valueType; !got.equals(wantType) || !wantType.equals(got) {
+		c.diags.error(methodNode.span, code, "`%s` returns %s but %s returns %s", methodNode.qualifiedName(), got, wanted, wantType)
+	}
+}
+
+func (c *Checker) declareMethod(methodNode *MethodNode) {
+	for j := range methodNode.parameters {
+		paramNode := &methodNode.parameters[j]
+		paramNode.symbol.valueType = c.typeFromName(paramNode.typeName, paramNode.span)
+		if paramNode.defaultValue != nil {
+			c.expect(paramNode.defaultValue, paramNode.symbol.valueType)
+		}
+	}
+	methodNode.symbol.valueType = voidType
+	if methodNode.returnType != "void" {
+		methodNode.symbol.valueType = c.typeFromName(methodNode.returnType, methodNode.span)
+	}
+}
+
+// declareFields types the fields of every class, inferring the type of a
+// field declared without one from its initializer.
+func (c *Checker) declareFields(instructions []InstNode) {
+	for i := range instructions {
+		if instructions[i].instType != INST_CLASS {
+			continue
+		}
+		fields := instructions[i].classNode.fields
+		for j := range fields {
+			fieldNode := &fields[j]
+			if fieldNode.typeName == "" {
+				fieldNode.symbol.valueType = c.checkValue(fieldNode.initializer)
+				continue
+			}
+			t := c.typeFromName(fieldNode.typeName, fieldNode.span)
+			fieldNode.symbol.valueType = t
+			if fieldNode.initializer != nil {
+				c.expect(fieldNode.initializer, t)
+			} else if !t.hasZeroValue() && t.kind != TYPE_CLASS && t.kind != TYPE_INTERFACE {
+				c.diags.error(fieldNode.span, ERR_TYPE_MISMATCH, "field `%s` needs an initial value because %s has no zero value", fieldNode.name, t)
+			}
+		}
+	}
+}
+
+func (c *Checker) typeFromName(typeName string, span Span) *Type {
+	if t, ok := primitiveTypes[typeName]; ok {
+		return t
+	}
+	if elemName, ok := strings.CutPrefix(typeName, "[]"); ok {
+		return c.arrayType(c.typeFromName(elemName, span), growable)
+	}
+	if rest, ok := strings.CutPrefix(typeName, "map["); ok {
+		// The key type may itself contain brackets, so find the one that
+		// closes `map[`.
+		depth := 0
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			if r == '[' {
+				depth++
+			} else if r == ']' {
+				depth--
+			}
+			return depth < 0
+		})
+		return c.mapType(c.typeFromName(rest[:end], span), c.typeFromName(rest[end+1:], span), span)
+	}
+	if open := strings.Index(typeName, "["); open > 0 {
+		// `int[2][3]` is an array of two `int[3]`.
+		t := c.typeFromName(typeName[:open], span)
+		lengths := strings.Split(strings.Trim(typeName[open:], "[]"), "][")
+		for i := len(lengths) - 1; i >= 0; i-- {
+			length, _ := strconv.Atoi(lengths[i])
+			t = c.arrayType(t, length)
+		}
+		return t
+	}
+	if t, ok := c.userTypes[typeName]; ok {
+		return t
+	}
+	c.diags.error(span, ERR_UNKNOWN_TYPE, "unknown type `%s`", typeName)
+	return invalidType
+}
+
+func (c *Checker) arrayType(elem *Type, length int) *Type {
+	if elem.kind == TYPE_INVALID {
+		return invalidType
+	}
+	return newArrayType(elem, length)
+}
+
+func (c *Checker) mapType(key *Type, elem *Type, span Span) *Type {
+	if !key.isHashable() {
+		c.diags.error(span, ERR_NOT_HASHABLE, "map keys must be int, bool or string but found %s", key)
+		return invalidType
+	}
+	if key.kind == TYPE_INVALID || elem.kind == TYPE_INVALID {
+		return invalidType
+	}
+	return newMapType(key, elem)
+}
+
+func (c *Checker) expect(exprNode *ExprNode, want *Type) {
+	if got := c.checkAgainst(exprNode, want); !want.equals(got) {
+		c.diags.error(exprNode.span, ERR_TYPE_MISMATCH, "expected a value of type %s but found %s", want, got)
+	}
+}
+
+// checkAgainst checks a value that flows into a place of type want and
+// returns its type. Array and map literals take their type from the place,
+// so that `[]` and `[1, 2]` can fill a variable of any matching array type.
+func (c *Checker) checkAgainst(exprNode *ExprNode, want *Type) *Type {
+	if exprNode.isMapLiteral() && want.kind == TYPE_MAP {
+		termNode := &exprNode.termNode
+		for i := range termNode.elements {
+			c.expect(&termNode.elements[i], want.key)
+			c.expect(&termNode.values[i], want.elem)
+		}
+		exprNode.valueType = want
+		return want
+	}
+	if !exprNode.isArrayLiteral() || want.kind != TYPE_ARRAY {
+		return c.checkValue(exprNode)
+	}
+	elements := exprNode.termNode.elements
+	if want.length != growable && len(elements) != want.length {
+		c.diags.error(exprNode.span, ERR_TYPE_MISMATCH, "expected %d elements for %s but found %d", want.length, want, len(elements))
+	}
+	for i := range elements {
+		c.expect(&elements[i], want.elem)
+	}
+	exprNode.valueType = want
+	return want
+}
+
+// checkValue checks an expression whose value is used, which rules out
+// calls to methods that do not return one.
+func (c *Checker) checkValue(exprNode *ExprNode) *Type {
+	t := c.checkExpr(exprNode)
+	if t.kind == TYPE_VOID {
+		c.diags.error(exprNode.span, ERR_TYPE_MISMATCH, "method `%s` does not return a value", exprNode.calleeName())
+		return invalidType
+	}
+	return t
+}
+
+func (c *Checker) checkInstructions(instructions []InstNode) {
+	for i := range instructions {
+		c.checkInst(&instructions[i])
+	}
+}
+
+func (c *Checker) checkInst(instNode *InstNode) {
+	switch instNode.instType {
+	case INST_ASSIGN:
+		assignNode := &instNode.assignNode
+		if assignNode.typeName == "" {
+			assignNode.symbol.valueType = c.checkValue(&assignNode.expr)
+		} else {
+			t := c.typeFromName(assignNode.typeName, assignNode.span)
+			assignNode.symbol.valueType = t
+			if assignNode.expr.exprType != "" {
+				c.expect(&assignNode.expr, t)
+			} else if !t.hasZeroValue() {
+				c.diags.error(assignNode.span, ERR_TYPE_MISMATCH, "`%s` needs an initial value because %s has no zero value", assignNode.identifier, t)
+			}
+		}
+	case INST_REASSIGN:
+		reassignNode := &instNode.reassignNode
+		want := c.checkValue(&reassignNode.target)
+		if reassignNode.operator == "" {
+			c.expect(&reassignNode.expr, want)
+		} else if t := c.binaryType(reassignNode.operator, want, c.checkExpr(&reassignNode.expr), reassignNode.span); !want.equals(t) {
+			c.diags.error(reassignNode.span, ERR_TYPE_MISMATCH, "expected a value of type %s but found %s", want, t)
+		}
+	case INST_IF:
+		c.expect(&instNode.ifNode.condNode, boolType)
+		c.checkInstructions(instNode.ifNode.ifBlockNode.instructions)
+		c.checkInstructions(instNode.ifNode.elseBlockNode.instructions)
+	case INST_WHILE:
+		c.expect(&instNode.whileNode.condNode, boolType)
+		c.checkInstructions(instNode.whileNode.blockNode.instructions)
+	case INST_FOR:
+		forNode := &instNode.forNode
+		if forNode.arrayNode.exprType != "" {
+			forNode.symbol.valueType = c.iteratedType(&forNode.arrayNode)
+		} else {
+			c.expect(&forNode.startNode, intType)
+			c.expect(&forNode.endNode, intType)
+			forNode.symbol.valueType = intType
+		}
+		c.checkInstructions(forNode.blockNode.instructions)
+	case INST_PRINT:
+		if t := c.checkValue(&instNode.printNode.exprNode); t.kind != TYPE_INT && t.kind != TYPE_BOOL && t.kind != TYPE_STRING && t.kind != TYPE_INVALID {
+			c.diags.error(instNode.printNode.exprNode.span, ERR_TYPE_MISMATCH, "cannot print a value of type %s", t)
+		}
+	case INST_RETURN:
+		c.checkReturn(&instNode.returnNode)
+	case INST_CALL:
+		c.checkExpr(&instNode.exprNode)
+	case INST_METHOD:
+		c.checkMethod(&instNode.methodNode)
+	case INST_CLASS:
+		for i := range instNode.classNode.methods {
+			c.checkMethod(&instNode.classNode.methods[i])
+		}
+	}
+}
+
+func (c *Checker) checkMethod(methodNode *MethodNode) {
+	method := c.method
+	c.method = methodNode
+	c.checkInstructions(methodNode.blockNode.instructions)
+	if methodNode.returnType != "void" && !methodNode.blockNode.alwaysReturns() {
+		c.diags.error(methodNode.span, ERR_MISSING_RETURN, "method `%s` can reach its end without returning a value", methodNode.methodName)
+	}
+	c.method = method
+}
+
+// checkReturn checks a return against the enclosing method. A return at the
+// top level ends the program, so its value is the exit status.
+func (c *Checker) checkReturn(returnNode *ReturnNode) {
+	hasValue := returnNode.exprNode.exprType != ""
+	if c.method == nil {
+		if hasValue {
+			c.expect(&returnNode.exprNode, intType)
+		}
+		return
+	}
+	want := c.method.symbol.valueType
+	if !hasValue {
+		if want.kind != TYPE_VOID {
+			c.diags.error(returnNode.span, ERR_TYPE_MISMATCH, "missing return value of type %s", want)
+		}
+		return
+	}
+	if want.kind == TYPE_VOID {
+		c.checkExpr(&returnNode.exprNode)
+		c.diags.error(returnNode.span, ERR_TYPE_MISMATCH, "method `%s` does not return a value", c.method.methodName)
+		return
+	}
+	c.expect(&returnNode.exprNode, want)
+}
+
+// checkCall checks a call and returns its result type. Calling a class by
+// name constructs an object, passing the arguments on to its init method.
+func (c *Checker) checkCall(callNode *CallNode) *Type {
+	switch callNode.symbol.kind {
+	case SYMBOL_BUILTIN:
+		return c.checkBuiltin(callNode)
+	case SYMBOL_CLASS:
+		classType := c.userTypes[callNode.methodName]
+		if init, ok := classType.classNode.members["init"]; ok && init.kind == SYMBOL_METHOD {
+			c.checkArguments(callNode, init.methodNode)
+		} else if len(callNode.arguments) > 0 {
+			c.diags.error(callNode.span, ERR_ARGUMENT_COUNT, "class `%s` has no `init` method and takes no arguments", callNode.methodName)
+		}
+		return classType
+	}
+	c.checkArguments(callNode, callNode.symbol.methodNode)
+	return callNode.symbol.valueType
+}
+
+// checkArguments checks the arguments of a call against the parameters of
+// the method. Defaults were checked with the method.
+func (c *Checker) checkArguments(callNode *CallNode, methodNode *MethodNode) {
+	name := methodNode.qualifiedName()
+	if _, ok := methodNode.bindArguments(callNode.arguments); !ok {
+		c.diags.error(callNode.span, ERR_ARGUMENT_COUNT, "method `%s` takes %s but %d were given", name, methodNode.describeArity(), len(callNode.arguments))
+		return
+	}
+	for i := range callNode.arguments {
+		argument := &callNode.arguments[i]
+		want := methodNode.parameters[i].symbol.valueType
+		if got := c.checkAgainst(argument, want); !want.equals(got) {
+			c.diags.error(argument.span, ERR_TYPE_MISMATCH, "argument %d of `%s` has type %s but %s is expected", i+1, name, got, want)
+		}
+	}
+}
+
+func (c *Checker) checkBuiltin(callNode *CallNode) *Type {
+	if arity := builtinArity[callNode.methodName]; len(callNode.arguments) != arity {
+		c.diags.error(callNode.span, ERR_ARGUMENT_COUNT, "`%s` takes %d argument(s) but %d were given", callNode.methodName, arity, len(callNode.arguments))
+		return invalidType
+	}
+	switch callNode.methodName {
+	case "len":
+		switch t := c.checkValue(&callNode.arguments[0]); t.kind {
+		case TYPE_STRING, TYPE_ARRAY, TYPE_MAP, TYPE_INVALID:
+		default:
+			c.diags.error(callNode.arguments[0].span, ERR_TYPE_MISMATCH, "expected a string, an array or a map but found %s", t)
+		}
+		return intType
+	case "push":
+		array := c.checkValue(&callNode.arguments[0])
+		if array.kind == TYPE_INVALID {
+			return voidType
+		}
+		if array.kind != TYPE_ARRAY || array.length != growable {
+			c.diags.error(callNode.arguments[0].span, ERR_TYPE_MISMATCH, "expected a growable array but found %s", array)
+			return voidType
+		}
+		c.expect(&callNode.arguments[1], array.elem)
+		return voidType
+	case "delete", "contains":
+		m := c.checkValue(&callNode.arguments[0])
+		if m.kind == TYPE_MAP {
+			c.expect(&callNode.arguments[1], m.key)
+		} else if m.kind != TYPE_INVALID {
+			c.diags.error(callNode.arguments[0].span, ERR_TYPE_MISMATCH, "expected a map but found %s", m)
+		}
+		if callNode.methodName == "contains" {
+			return boolType
+		}
+		return voidType
+	}
+	return invalidType
+}
+
+// iteratedType checks the expression a for loop runs over and returns the
+// type of the loop variable: the elements of an array or the keys of a map.
+func (c *Checker) iteratedType(exprNode *ExprNode) *Type {
+	switch t := c.checkValue(exprNode); t.kind {
+	case TYPE_ARRAY:
+		return t.elem
+	case TYPE_MAP:
+		return t.key
+	case TYPE_INVALID:
+	default:
+		c.diags.error(exprNode.span, ERR_TYPE_MISMATCH, "expected an array or a map but found %s", t)
+	}
+	return invalidType
+}
+
+// checkIndex checks `a[i]`, which reads an element of an array or the
+// value of a key in a map.
+func (c *Checker) checkIndex(indexNode *IndexNode) *Type {
+	switch t := c.checkValue(indexNode.array); t.kind {
+	case TYPE_ARRAY:
+		c.expect(indexNode.index, intType)
+		return t.elem
+	case TYPE_MAP:
+		c.expect(indexNode.index, t.key)
+		return t.elem
+	case TYPE_INVALID:
+	default:
+		c.diags.error(indexNode.array.span, ERR_TYPE_MISMATCH, "expected an array or a map but found %s", t)
+	}
+	c.checkValue(indexNode.index)
+	return invalidType
+}
+
+func (c *Checker) checkExpr(exprNode *ExprNode) *Type {
+	var t *Type
+	switch exprNode.exprType {
+	case EXPR_TERM:
+		t = c.checkTerm(&exprNode.termNode)
+	case EXPR_NEGATE:
+		c.expect(exprNode.exprUnaryNode.operand, intType)
+		t = intType
+	case EXPR_NOT:
+		c.expect(exprNode.exprUnaryNode.operand, boolType)
+		t = boolType
+	case EXPR_MEMBER, EXPR_MEMBER_CALL:
+		t = c.checkMember(exprNode)
+	case EXPR_INDEX:
+		t = c.checkIndex(&exprNode.indexNode)
+	default:
+		lhs := c.checkValue(exprNode.exprBinaryNode.lhs)
+		rhs := c.checkValue(exprNode.exprBinaryNode.rhs)
+		t = c.binaryType(exprNode.exprType, lhs, rhs, exprNode.span)
+	}
+	exprNode.valueType = t
+	return t
+}
+
+// checkMember looks the member up in the class of the object and binds it.
+func (c *Checker) checkMember(exprNode *ExprNode) *Type {
+	memberNode := &exprNode.memberNode
+	object := c.checkValue(memberNode.object)
+	if object.kind == TYPE_INVALID {
+		return invalidType
+	}
+	if object.kind == TYPE_INTERFACE {
+		return c.checkInterfaceCall(exprNode, object)
+	}
+	if object.kind != TYPE_CLASS {
+		c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "a value of type %s has no member `%s`", object, memberNode.name)
+		return invalidType
+	}
+	symbol := object.classNode.members[memberNode.name]
+	if symbol == nil {
+		c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "class `%s` has no member `%s`", object, memberNode.name)
+		return invalidType
+	}
+	memberNode.symbol = symbol
+	if exprNode.exprType == EXPR_MEMBER_CALL {
+		if symbol.kind != SYMBOL_METHOD {
+			c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "`%s` is a field of class `%s`, not a method", memberNode.name, object)
+			return invalidType
+		}
+		memberNode.callNode.symbol = symbol
+		return c.checkCall(&memberNode.callNode)
+	}
+	if symbol.kind != SYMBOL_FIELD {
+		c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "method `%s` of class `%s` must be called", memberNode.name, object)
+		return invalidType
+	}
+	if symbol.valueType == nil {
+		c.diags.error(memberNode.span, ERR_TYPE_MISMATCH, "the type of field `%s` is not known yet; declare it with a type", memberNode.name)
+		return invalidType
+	}
+	return symbol.valueType
+}
+
+// checkInterfaceCall binds a method called on an interface value. Interfaces
+// have no fields.
+func (c *Checker) checkInterfaceCall(exprNode *ExprNode, object *Type) *Type {
+	memberNode := &exprNode.memberNode
+	symbol := object.interfaceNode.members[memberNode.name]
+	if symbol == nil {
+		c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "interface `%s` has no method `%s`", object, memberNode.name)
+		return invalidType
+	}
+	memberNode.symbol = symbol
+	if exprNode.exprType != EXPR_MEMBER_CALL {
+		c.diags.error(memberNode.span, ERR_UNKNOWN_MEMBER, "method `%s` of interface `%s` must be called", memberNode.name, object)
+		return invalidType
+	}
+	memberNode.callNode.symbol = symbol
+	return c.checkCall(&memberNode.callNode)
+}
+
+// binaryType returns the result type of applying a binary operator to
+// operands of the given types, reporting operands it does not accept.
+func (c *Checker) binaryType(exprType ExprType, lhs *Type, rhs *Type, span Span) *Type {
+	operand, result := intType, intType
+	switch exprType {
+	case EXPR_PLUS:
+		if lhs.kind == TYPE_STRING {
+			operand, result = stringType, stringType
+		}
+	case EXPR_AND, EXPR_OR:
+		operand, result = boolType, boolType
+	case EXPR_LESS_THAN, EXPR_GREATER_THAN, EXPR_LESS_THAN_EQUAL, EXPR_GREATER_THAN_EQUAL:
+		result = boolType
+	case EXPR_EQUAL, EXPR_NOT_EQUAL:
+		if !lhs.equals(rhs) && !rhs.equals(lhs) {
+			c.diags.error(span, ERR_TYPE_MISMATCH, "cannot compare %s with %s", lhs, rhs)
+		}
+		return boolType
+	}
+	if !operand.equals(lhs) || !operand.equals(rhs) {
+		c.diags.error(span, ERR_TYPE_MISMATCH, "`%s` expects %s operands but found %s and %s", exprType.spelling(), operand, lhs, rhs)
+		return invalidType
+	}
+	return result
+}
+
+func (c *Checker) checkTerm(termNode *TermNode) *Type {
+	switch termNode.termType {
+	case TERM_INT:
+		return intType
+	case TERM_INPUT:
+		t := c.typeFromName(termNode.value, termNode.span)
+		if t.kind != TYPE_INT && t.kind != TYPE_STRING && t.kind != TYPE_INVALID {
+			c.diags.error(termNode.span, ERR_TYPE_MISMATCH, "`input` can only read int or string values, not %s", t)
+			return invalidType
+		}
+		return t
+	case TERM_BOOL:
+		return boolType
+	case TERM_STRING:
+		return stringType
+	case TERM_IDENT:
+		return termNode.symbol.valueType
+	case TERM_CALL:
+		return c.checkCall(&termNode.callNode)
+	case TERM_ARRAY:
+		// Without a type to fill, the literal is a growable array of the
+		// type of its first element.
+		if len(termNode.elements) == 0 {
+			c.diags.error(termNode.span, ERR_TYPE_MISMATCH, "cannot infer the element type of an empty array")
+			return invalidType
+		}
+		elem := c.checkValue(&termNode.elements[0])
+		for i := 1; i < len(termNode.elements); i++ {
+			c.expect(&termNode.elements[i], elem)
+		}
+		return c.arrayType(elem, growable)
+	case TERM_MAP:
+		// Likewise a map takes the types of its first key and value.
+		if len(termNode.elements) == 0 {
+			c.diags.error(termNode.span, ERR_TYPE_MISMATCH, "cannot infer the key and value types of an empty map")
+			return invalidType
+		}
+		key := c.checkValue(&termNode.elements[0])
+		elem := c.checkValue(&termNode.values[0])
+		for i := 1; i < len(termNode.elements); i++ {
+			c.expect(&termNode.elements[i], key)
+			c.expect(&termNode.values[i], elem)
+		}
+		return c.mapType(key, elem, termNode.elements[0].span)
+	}
+	return invalidType
+}
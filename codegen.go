@@ -12,38 +12,87 @@ import (
 )
 
 type Compiler struct {
-	programNode    ProgramNode
-	module         *ir.Module
-	currentContext Context
+	programNode ProgramNode
+	module      *ir.Module
+	diags       *Diagnostics
+	methods     map[string]*ir.Func
+	// stringType is the runtime string, a pointer to the characters and a
+	// length. The characters are not NUL terminated.
+	stringType types.Type
+	literals   map[string]constant.Constant
+	// arrayType is the header every array points to: its length, its
+	// capacity and its elements.
+	arrayType types.Type
+	// mapType is the header every map points to, laid out as described by
+	// mapCount and the other map fields.
+	mapType types.Type
+	// classTypes holds the struct type of every class. Objects are pointers
+	// to these structs, whose first field points to the vtable of the class
+	// and whose other fields follow the layout of the class.
+	classTypes map[string]*types.StructType
+	classNodes map[*types.StructType]*ClassNode
+	vtables    map[string]*ir.Global
+	// interfaceTypes holds the type of the values of every interface: a
+	// pointer to the object and a pointer to its method table.
+	interfaceTypes map[string]*types.StructType
+	interfaceNodes map[*types.StructType]*InterfaceNode
+	methodTables   map[string]*ir.Global
 }
 
+// Context is the block being filled in. vars holds the stack slot of every
+// resolved variable of the current function and is shared by all of its
+// contexts.
 type Context struct {
 	*ir.Block
-	parent   *Context
-	vars     map[string]value.Value
+	vars     map[*Symbol]*ir.InstAlloca
 	compiler *Compiler
+	loop     *loopTargets
+}
+
+// loopTargets are the blocks that break and continue jump to inside the
+// innermost enclosing loop.
+type loopTargets struct {
+	breakBlock    *ir.Block
+	continueBlock *ir.Block
 }
 
 func NewCString(s string) *constant.CharArray {
 	return constant.NewCharArrayFromString(s + "\x00")
 }
 
-func newCompiler(programNode ProgramNode) Compiler {
-	return Compiler{programNode, ir.NewModule(), Context{}}
+func newCompiler(programNode ProgramNode, diags *Diagnostics) Compiler {
+	module := ir.NewModule()
+	return Compiler{
+		programNode: programNode,
+		module:      module,
+		diags:       diags,
+		methods:     make(map[string]*ir.Func),
+		stringType:  module.NewTypeDef("string", types.NewStruct(types.I8Ptr, types.I32)),
+		literals:    make(map[string]constant.Constant),
+		arrayType:   module.NewTypeDef("yeol.array", types.NewStruct(types.I32, types.I32, types.I8Ptr)),
+		mapType:     module.NewTypeDef("yeol.map", types.NewStruct(types.I32, types.I32, types.I32, types.I8Ptr, types.I8Ptr, types.I8Ptr)),
+		classTypes:  make(map[string]*types.StructType),
+		vtables:     make(map[string]*ir.Global),
+		classNodes:  make(map[*types.StructType]*ClassNode),
+
+		interfaceTypes: make(map[string]*types.StructType),
+		interfaceNodes: make(map[*types.StructType]*InterfaceNode),
+		methodTables:   make(map[string]*ir.Global),
+	}
 }
 
 func newContext(b *ir.Block, compiler *Compiler) *Context {
 	return &Context{
 		Block:    b,
-		parent:   nil,
-		vars:     make(map[string]value.Value),
+		vars:     make(map[*Symbol]*ir.InstAlloca),
 		compiler: compiler,
 	}
 }
 
 func (c *Context) newContext(b *ir.Block) *Context {
 	ctx := newContext(b, c.compiler)
-	ctx.parent = c
+	ctx.vars = c.vars
+	ctx.loop = c.loop
 	return ctx
 }
 
@@ -51,35 +100,90 @@ func (c *Compiler) compileProgram() {
 	printf := c.module.NewFunc("printf", types.I32,
 		ir.NewParam("format", types.NewPointer(types.I8)))
 	printf.Sig.Variadic = true
+	c.module.NewFunc("malloc", types.I8Ptr, ir.NewParam("size", types.I64))
+	c.module.NewFunc("memcpy", types.I8Ptr,
+		ir.NewParam("dest", types.I8Ptr), ir.NewParam("src", types.I8Ptr), ir.NewParam("n", types.I64))
+	c.module.NewFunc("memcmp", types.I32,
+		ir.NewParam("s1", types.I8Ptr), ir.NewParam("s2", types.I8Ptr), ir.NewParam("n", types.I64))
 	c.module.NewGlobalDef("printIntegerFormat", NewCString("%d\n"))
+	c.module.NewGlobalDef("printStringFormat", NewCString("%.*s\n"))
 
 	mainFunc := c.module.NewFunc("main", types.I32)
 	b := mainFunc.NewBlock("")
 	starterContext := newContext(b, c)
-	currentContext := *starterContext
-	// c.currentContext.NewRet(constant.NewInt(types.I32, 0))
+	// Class types are named before their fields are filled in so that
+	// fields can hold objects of any class or interface.
+	for i := range c.programNode.instructions {
+		switch inst := &c.programNode.instructions[i]; inst.instType {
+		case INST_CLASS:
+			st := c.module.NewTypeDef(inst.classNode.className, &types.StructType{}).(*types.StructType)
+			c.classTypes[inst.classNode.className] = st
+			c.classNodes[st] = &inst.classNode
+		case INST_INTERFACE:
+			st := c.module.NewTypeDef(inst.interfaceNode.name, types.NewStruct(types.I8Ptr, types.I32Ptr)).(*types.StructType)
+			c.interfaceTypes[inst.interfaceNode.name] = st
+			c.interfaceNodes[st] = &inst.interfaceNode
+		}
+	}
 	for _, inst := range c.programNode.instructions {
-		currentContext = *currentContext.compileInst(inst)
+		if inst.instType == INST_CLASS {
+			st := c.classTypes[inst.classNode.className]
+			st.Fields = []types.Type{vtablePointerType}
+			for _, field := range inst.classNode.layout {
+				st.Fields = append(st.Fields, c.llvmType(field.valueType))
+			}
+		}
+	}
+	// Methods are declared up front so that calls can appear before the
+	// definition and methods can recurse.
+	for _, inst := range c.programNode.instructions {
+		switch inst.instType {
+		case INST_METHOD:
+			starterContext.declareMethod(inst.methodNode)
+		case INST_CLASS:
+			for _, methodNode := range inst.classNode.methods {
+				starterContext.declareMethod(methodNode)
+			}
+		}
+	}
+	for _, inst := range c.programNode.instructions {
+		if inst.instType == INST_CLASS {
+			c.defineVtable(inst.classNode)
+		}
+	}
+	currentContext := starterContext.compileBlock(BlockNode{instructions: c.programNode.instructions})
+	if currentContext.Term == nil {
+		currentContext.NewRet(constant.NewInt(types.I32, 0))
 	}
-	currentContext.NewRet(constant.NewInt(types.I32, 0))
 }
 
 func (c *Context) compileBlock(blockNode BlockNode) *Context {
 	currentContext := c
 	for _, inst := range blockNode.instructions {
+		if currentContext.Term != nil {
+			// Anything after a return, break or continue is unreachable, but
+			// it still needs a block to live in.
+			currentContext.Block = currentContext.Parent.NewBlock("")
+		}
 		currentContext = currentContext.compileInst(inst)
 	}
 	return currentContext
 }
 
+// newAlloca reserves a stack slot in the entry block of the current function
+// so that loops do not grow the stack on every iteration.
+func (c *Context) newAlloca(t types.Type) *ir.InstAlloca {
+	return c.Parent.Blocks[0].NewAlloca(t)
+}
+
 func (c *Context) compileAssign(assignNode AssignNode) {
-	var v *ir.InstAlloca
-	switch assignNode.typeName {
-	case "int":
-		v = c.NewAlloca(types.I32)
+	v := c.newAlloca(c.compiler.llvmType(assignNode.symbol.valueType))
+	if assignNode.expr.exprType == "" {
+		c.NewStore(c.zeroValue(assignNode.symbol.valueType), v)
+	} else {
+		c.store(c.compileExpr(assignNode.expr), v)
 	}
-	c.NewStore(c.compileExpr(assignNode.expr), v)
-	c.vars[assignNode.identifier] = v
+	c.vars[assignNode.symbol] = v
 }
 
 func (c *Context) compileInst(instNode InstNode) *Context {
@@ -88,120 +192,847 @@ func (c *Context) compileInst(instNode InstNode) *Context {
 	case INST_ASSIGN:
 		c.compileAssign(instNode.assignNode)
 		return c
+	case INST_REASSIGN:
+		reassignNode := instNode.reassignNode
+		target := reassignNode.target
+		if target.exprType != EXPR_INDEX {
+			address := c.compileAddress(target)
+			v := c.compileExpr(reassignNode.expr)
+			if reassignNode.operator != "" {
+				old := c.NewLoad(c.compiler.llvmType(target.valueType), address)
+				v = c.compileBinary(reassignNode.operator, target.valueType, old, v, reassignNode.span)
+			}
+			c.store(v, address)
+			return c
+		}
+		// The element is looked up only after the value is computed, since
+		// computing it may grow the array or map and move its elements.
+		container := c.compileExpr(*target.indexNode.array)
+		index := c.compileExpr(*target.indexNode.index)
+		v := c.compileExpr(reassignNode.expr)
+		if reassignNode.operator != "" {
+			old := c.NewLoad(c.compiler.llvmType(target.valueType), c.elementAddress(target, container, index, false))
+			v = c.compileBinary(reassignNode.operator, target.valueType, old, v, reassignNode.span)
+		}
+		c.store(v, c.elementAddress(target, container, index, true))
+		return c
 	case INST_IF:
+		cond := c.compileExpr(instNode.ifNode.condNode)
 		thenBlock := f.NewBlock("")
-		thenInCtx := c.newContext(thenBlock)
-		thenCtx := thenInCtx.compileBlock(instNode.ifNode.ifBlockNode)
 		leaveBlock := f.NewBlock("")
-		c.NewCondBr(c.compileRel(instNode.ifNode.relNode), thenInCtx.Block, leaveBlock)
+		elseBlock := leaveBlock
 		if len(instNode.ifNode.elseBlockNode.instructions) > 0 {
-			elseBlock := f.NewBlock("")
-			elseInCtx := c.newContext(elseBlock)
-			elseCtx := elseInCtx.compileBlock(instNode.ifNode.elseBlockNode)
-			c.NewCondBr(c.compileRel(instNode.ifNode.relNode), thenInCtx.Block, elseInCtx.Block)
-			elseCtx.NewBr(leaveBlock)
+			elseBlock = f.NewBlock("")
+			elseCtx := c.newContext(elseBlock).compileBlock(instNode.ifNode.elseBlockNode)
+			if elseCtx.Term == nil {
+				elseCtx.NewBr(leaveBlock)
+			}
+		}
+		c.NewCondBr(cond, thenBlock, elseBlock)
+		thenCtx := c.newContext(thenBlock).compileBlock(instNode.ifNode.ifBlockNode)
+		if thenCtx.Term == nil {
+			thenCtx.NewBr(leaveBlock)
 		}
-		thenCtx.NewBr(leaveBlock)
 
-		return c.newContext(leaveBlock)
+		c.Block = leaveBlock
+		return c
+	case INST_WHILE:
+		condBlock := f.NewBlock("")
+		bodyBlock := f.NewBlock("")
+		leaveBlock := f.NewBlock("")
+		c.NewBr(condBlock)
+		c.Block = condBlock
+		c.NewCondBr(c.compileExpr(instNode.whileNode.condNode), bodyBlock, leaveBlock)
+
+		bodyCtx := c.newContext(bodyBlock)
+		bodyCtx.loop = &loopTargets{leaveBlock, condBlock}
+		bodyCtx = bodyCtx.compileBlock(instNode.whileNode.blockNode)
+		if bodyCtx.Term == nil {
+			bodyCtx.NewBr(condBlock)
+		}
+
+		c.Block = leaveBlock
+		return c
+	case INST_FOR:
+		c.compileFor(instNode.forNode)
+		return c
+	case INST_BREAK:
+		c.NewBr(c.loop.breakBlock)
+		return c
+	case INST_CONTINUE:
+		c.NewBr(c.loop.continueBlock)
+		return c
 	case INST_PRINT:
-		zero := constant.NewInt(types.I32, 0)
-		printIntegerFormat := c.getPrintIntegerFormat()
-		pointerToString := c.NewGetElementPtr(types.NewArray(3, types.I8), printIntegerFormat, zero, zero)
-		c.NewCall(c.getPrintfFunc(),
-			pointerToString,
-			c.compileTerm(instNode.printNode.termNode))
+		c.compilePrint(instNode.printNode)
 		return c
 	case INST_METHOD:
-		returnType := c.getTypeFromName(instNode.methodNode.returnType)
-		params := c.getMethodParams(instNode.methodNode)
-		fnc := c.compiler.module.NewFunc(instNode.methodNode.methodName, returnType, params...)
-		c.newContext(fnc.NewBlock("")).compileBlock(instNode.methodNode.blockNode)
+		c.compileMethod(instNode.methodNode)
 		return c
 	case INST_RETURN:
-		c.NewRet(c.compileExpr(instNode.returnNode.exprNode))
+		c.compileReturn(instNode.returnNode)
+		return c
+	case INST_CALL:
+		c.compileExpr(instNode.exprNode)
+		return c
+	case INST_CLASS:
+		for _, methodNode := range instNode.classNode.methods {
+			c.compileMethod(methodNode)
+		}
+		return c
+	case INST_INTERFACE:
+		// Interfaces only describe methods; their types are already declared.
 		return c
 	}
 	panic("Error no context to return")
 }
 
+// compileFor lowers every kind of for loop to a counter that runs up to the
+// end of the range, the length of the array or the capacity of the map.
+// Over an array or map, the loop variable gets its own slot holding the
+// current element or key, and the bound is read again on every iteration
+// since the body may grow the array or map.
+func (c *Context) compileFor(forNode ForNode) {
+	f := c.Parent
+	counter := c.newAlloca(types.I32)
+	var array, end value.Value
+	variable := counter
+	iterated := forNode.arrayNode.valueType
+	if forNode.arrayNode.exprType != "" {
+		array = c.compileExpr(forNode.arrayNode)
+		c.NewStore(constant.NewInt(types.I32, 0), counter)
+		variable = c.newAlloca(c.compiler.llvmType(forNode.symbol.valueType))
+	} else {
+		c.NewStore(c.compileExpr(forNode.startNode), counter)
+		end = c.compileExpr(forNode.endNode)
+	}
+	condBlock := f.NewBlock("")
+	bodyBlock := f.NewBlock("")
+	stepBlock := f.NewBlock("")
+	leaveBlock := f.NewBlock("")
+	c.NewBr(condBlock)
+	c.Block = condBlock
+	switch {
+	case array != nil && iterated.kind == TYPE_MAP:
+		end = c.NewLoad(types.I32, mapField(c.Block, c.compiler.mapType, array, mapCapacity))
+	case array != nil:
+		end = c.NewLoad(types.I32, arrayField(c.Block, c.compiler.arrayType, array, arrayLength))
+	}
+	c.NewCondBr(c.NewICmp(enum.IPredSLT, c.NewLoad(types.I32, counter), end), bodyBlock, leaveBlock)
+
+	bodyCtx := c.newContext(bodyBlock)
+	if array != nil && iterated.kind == TYPE_MAP {
+		// Slots that hold no key are skipped.
+		i := bodyCtx.NewLoad(types.I32, counter)
+		states := bodyCtx.NewLoad(types.I8Ptr, mapField(bodyCtx.Block, c.compiler.mapType, array, mapStates))
+		state := bodyCtx.NewLoad(types.I8, bodyCtx.NewGetElementPtr(types.I8, states, i))
+		keyBlock := f.NewBlock("")
+		bodyCtx.NewCondBr(bodyCtx.NewICmp(enum.IPredEQ, state, constant.NewInt(types.I8, slotFull)), keyBlock, stepBlock)
+		bodyCtx.Block = keyBlock
+		keyType := c.compiler.keyType(forNode.symbol.valueType)
+		keys := bodyCtx.NewBitCast(bodyCtx.NewLoad(types.I8Ptr, mapField(bodyCtx.Block, c.compiler.mapType, array, mapKeys)), types.NewPointer(keyType))
+		key := bodyCtx.NewLoad(keyType, bodyCtx.NewGetElementPtr(keyType, keys, i))
+		bodyCtx.NewStore(bodyCtx.fromKey(key, forNode.symbol.valueType), variable)
+	} else if array != nil {
+		element := bodyCtx.elementPointer(array, bodyCtx.NewLoad(types.I32, counter), forNode.symbol.valueType)
+		bodyCtx.NewStore(bodyCtx.NewLoad(variable.ElemType, element), variable)
+	}
+	bodyCtx.vars[forNode.symbol] = variable
+	bodyCtx.loop = &loopTargets{leaveBlock, stepBlock}
+	bodyCtx = bodyCtx.compileBlock(forNode.blockNode)
+	if bodyCtx.Term == nil {
+		bodyCtx.NewBr(stepBlock)
+	}
+
+	c.Block = stepBlock
+	c.NewStore(c.NewAdd(c.NewLoad(types.I32, counter), constant.NewInt(types.I32, 1)), counter)
+	c.NewBr(condBlock)
+
+	c.Block = leaveBlock
+}
+
+// declareMethod declares the function of a method. Its name starts with
+// yeol.m. so that no method can take the name of a function of the C
+// library or of the runtime, and methods of a class are named after the
+// class, as in `yeol.m.Point.move`.
+func (c Context) declareMethod(methodNode MethodNode) {
+	name := methodNode.qualifiedName()
+	returnType := c.compiler.llvmType(methodNode.symbol.valueType)
+	params := c.getMethodParams(methodNode)
+	c.compiler.methods[name] = c.compiler.module.NewFunc("yeol.m."+name, returnType, params...)
+}
+
+// vtablePointerType is the type of the first field of every object.
+var vtablePointerType = types.NewPointer(types.I8Ptr)
+
+// defineVtable emits the vtable of a class as a constant array holding the
+// function of every method in dispatch order. Calls cast an entry back to the
+// signature of the method they look up.
+func (c *Compiler) defineVtable(classNode ClassNode) {
+	entries := []constant.Constant{}
+	for _, method := range classNode.vtable {
+		entries = append(entries, constant.NewBitCast(c.methods[method.methodNode.qualifiedName()], types.I8Ptr))
+	}
+	vtable := c.module.NewGlobalDef("yeol.vtable."+classNode.className, constant.NewArray(types.NewArray(uint64(len(entries)), types.I8Ptr), entries...))
+	vtable.Linkage = enum.LinkagePrivate
+	vtable.Immutable = true
+	c.vtables[classNode.className] = vtable
+}
+
+// compileMethod emits the body of a declared method. Methods get a fresh
+// context so they cannot see the variables of the code around them.
+func (c Context) compileMethod(methodNode MethodNode) {
+	fnc := c.compiler.methods[methodNode.qualifiedName()]
+	if fnc == nil || len(fnc.Blocks) > 0 {
+		return
+	}
+	methodCtx := newContext(fnc.NewBlock(""), c.compiler)
+	for i, symbol := range methodNode.paramSymbols() {
+		param := fnc.Params[i]
+		slot := methodCtx.newAlloca(param.Typ)
+		methodCtx.NewStore(param, slot)
+		methodCtx.vars[symbol] = slot
+	}
+	endCtx := methodCtx.compileBlock(methodNode.blockNode)
+	if endCtx.Term != nil {
+		return
+	}
+	// The checker guarantees that methods with a value return on every
+	// path, so only void methods can fall off the end.
+	if fnc.Sig.RetType.Equal(types.Void) {
+		endCtx.NewRet(nil)
+		return
+	}
+	endCtx.NewUnreachable()
+}
+
+func (c *Context) compileReturn(returnNode ReturnNode) {
+	if returnNode.exprNode.exprType != "" {
+		c.NewRet(c.coerce(c.compileExpr(returnNode.exprNode), c.Parent.Sig.RetType))
+	} else if c.Parent.Name() == "main" {
+		c.NewRet(constant.NewInt(types.I32, 0))
+	} else {
+		c.NewRet(nil)
+	}
+}
+
+func (c *Context) compileCall(callNode CallNode) value.Value {
+	switch callNode.symbol.kind {
+	case SYMBOL_BUILTIN:
+		return c.compileBuiltin(callNode)
+	case SYMBOL_CLASS:
+		return c.compileConstruct(callNode)
+	}
+	return c.callMethod(callNode, nil)
+}
+
+// callMethod emits a direct call to a resolved method. Methods of a class
+// get the object as self.
+func (c *Context) callMethod(callNode CallNode, self value.Value) value.Value {
+	fnc, ok := c.compiler.methods[callNode.symbol.methodNode.qualifiedName()]
+	if !ok {
+		return constant.NewInt(types.I32, 0)
+	}
+	return c.callWith(fnc, fnc.Sig, callNode, self)
+}
+
+// compileDispatch calls a method of an object through the vtable of the
+// object, so that the override of its dynamic class runs.
+func (c *Context) compileDispatch(memberNode MemberNode) value.Value {
+	if memberNode.object.valueType.kind == TYPE_INTERFACE {
+		return c.compileInterfaceCall(memberNode)
+	}
+	object := c.compileObject(*memberNode.object)
+	fnc, ok := c.compiler.methods[memberNode.symbol.methodNode.qualifiedName()]
+	if !ok {
+		return constant.NewInt(types.I32, 0)
+	}
+	st := c.compiler.classTypes[memberNode.object.valueType.name]
+	zero := constant.NewInt(types.I32, 0)
+	vtable := c.NewLoad(vtablePointerType, c.NewGetElementPtr(st, object, zero, zero))
+	entry := c.NewGetElementPtr(types.I8Ptr, vtable, constant.NewInt(types.I32, int64(memberNode.symbol.slot)))
+	callee := c.NewBitCast(c.NewLoad(types.I8Ptr, entry), types.NewPointer(fnc.Sig))
+	return c.callWith(callee, fnc.Sig, memberNode.callNode, object)
+}
+
+// compileInterfaceCall calls a method on an interface value. The method table
+// gives the vtable slot of the method, and the call goes through the vtable
+// of the object from there. The object is passed as an untyped pointer.
+func (c *Context) compileInterfaceCall(memberNode MemberNode) value.Value {
+	v := c.compileExpr(*memberNode.object)
+	object := c.NewExtractValue(v, 0)
+	c.NewCall(c.compiler.objectCheckFunc(), object, c.compiler.location(memberNode.object.span))
+	table := c.NewExtractValue(v, 1)
+	slot := c.NewLoad(types.I32, c.NewGetElementPtr(types.I32, table, constant.NewInt(types.I32, int64(memberNode.symbol.slot))))
+	vtable := c.NewLoad(vtablePointerType, c.NewBitCast(object, types.NewPointer(vtablePointerType)))
+	entry := c.NewLoad(types.I8Ptr, c.NewGetElementPtr(types.I8Ptr, vtable, slot))
+
+	methodNode := memberNode.symbol.methodNode
+	params := []types.Type{types.I8Ptr}
+	for _, paramNode := range methodNode.parameters {
+		params = append(params, c.compiler.llvmType(paramNode.symbol.valueType))
+	}
+	sig := types.NewFunc(c.compiler.llvmType(methodNode.symbol.valueType), params...)
+	return c.callWith(c.NewBitCast(entry, types.NewPointer(sig)), sig, memberNode.callNode, object)
+}
+
+// callWith calls callee, filling in the values of omitted default parameters
+// and passing objects as the classes the signature expects.
+func (c *Context) callWith(callee value.Value, sig *types.FuncType, callNode CallNode, self value.Value) value.Value {
+	arguments, _ := callNode.symbol.methodNode.bindArguments(callNode.arguments)
+	args := []value.Value{}
+	if self != nil {
+		args = append(args, self)
+	}
+	for _, argument := range arguments {
+		args = append(args, c.compileExpr(argument))
+	}
+	for i := range args {
+		args[i] = c.coerce(args[i], sig.Params[i])
+	}
+	return c.NewCall(callee, args...)
+}
+
+// coerce converts an object to a pointer to one of its base classes, whose
+// fields and vtable are a prefix of its own, or to an interface it
+// implements. Other values are unchanged.
+func (c *Context) coerce(v value.Value, t types.Type) value.Value {
+	if v.Type().Equal(t) {
+		return v
+	}
+	switch t := t.(type) {
+	case *types.PointerType:
+		return c.NewBitCast(v, t)
+	case *types.StructType:
+		if interfaceNode, ok := c.compiler.interfaceNodes[t]; ok {
+			classNode := c.compiler.classNodes[v.Type().(*types.PointerType).ElemType.(*types.StructType)]
+			return c.toInterface(v, classNode, interfaceNode)
+		}
+	}
+	return v
+}
+
+// toInterface wraps an object in an interface value that carries the method
+// table of its class for the interface.
+func (c *Context) toInterface(object value.Value, classNode *ClassNode, interfaceNode *InterfaceNode) value.Value {
+	table := c.compiler.methodTable(classNode, interfaceNode)
+	zero := constant.NewInt(types.I32, 0)
+	v := c.NewInsertValue(constant.NewUndef(c.compiler.interfaceTypes[interfaceNode.name]), c.NewBitCast(object, types.I8Ptr), 0)
+	return c.NewInsertValue(v, constant.NewGetElementPtr(table.ContentType, table, zero, zero), 1)
+}
+
+// methodTable returns the method table of a class for an interface. It maps
+// each method of the interface to the vtable slot of the method of the class,
+// so that calls still reach the overrides of derived classes.
+func (c *Compiler) methodTable(classNode *ClassNode, interfaceNode *InterfaceNode) *ir.Global {
+	name := "yeol.itable." + classNode.className + "." + interfaceNode.name
+	if table, ok := c.methodTables[name]; ok {
+		return table
+	}
+	slots := []constant.Constant{}
+	for _, methodNode := range interfaceNode.methods {
+		slots = append(slots, constant.NewInt(types.I32, int64(classNode.members[methodNode.methodName].slot)))
+	}
+	table := c.module.NewGlobalDef(name, constant.NewArray(types.NewArray(uint64(len(slots)), types.I32), slots...))
+	table.Linkage = enum.LinkagePrivate
+	table.Immutable = true
+	c.methodTables[name] = table
+	return table
+}
+
+// objectPointer returns the address of the object held by a class or
+// interface value, for comparing objects by identity.
+func (c *Context) objectPointer(v value.Value) value.Value {
+	if _, ok := v.Type().(*types.StructType); ok {
+		return c.NewExtractValue(v, 0)
+	}
+	return c.NewBitCast(v, types.I8Ptr)
+}
+
+// store writes v to ptr, converting objects to the class the slot holds.
+func (c *Context) store(v value.Value, ptr value.Value) {
+	c.NewStore(c.coerce(v, ptr.Type().(*types.PointerType).ElemType), ptr)
+}
+
+// compileConstruct allocates an object on the heap, points it at the vtable
+// of its class, stores the initial value of every field and runs init if the
+// class has one. Objects are never freed.
+func (c *Context) compileConstruct(callNode CallNode) value.Value {
+	classNode := callNode.symbol.classNode
+	st := c.compiler.classTypes[classNode.className]
+	memory := c.NewCall(c.getFunc("malloc"), sizeOf(st))
+	object := c.NewBitCast(memory, types.NewPointer(st))
+	zero := constant.NewInt(types.I32, 0)
+	vtable := c.compiler.vtables[classNode.className]
+	c.NewStore(constant.NewGetElementPtr(vtable.ContentType, vtable, zero, zero), c.NewGetElementPtr(st, object, zero, zero))
+	c.initFields(object, classNode)
+	if init, ok := classNode.members["init"]; ok && init.kind == SYMBOL_METHOD {
+		callNode.symbol = init
+		c.callMethod(callNode, object)
+	}
+	return object
+}
+
+// initFields stores the initial values of the fields a class declares,
+// after those of its base classes.
+func (c *Context) initFields(object value.Value, classNode *ClassNode) {
+	if classNode.base != nil {
+		c.initFields(object, classNode.base)
+	}
+	for _, fieldNode := range classNode.fields {
+		address := c.fieldAddress(object, fieldNode.symbol)
+		if fieldNode.initializer == nil {
+			c.NewStore(c.zeroValue(fieldNode.symbol.valueType), address)
+		} else {
+			c.store(c.compileExpr(*fieldNode.initializer), address)
+		}
+	}
+}
+
+// fieldAddress returns a pointer to a field of an object. Fields come after
+// the vtable pointer, and an object of a derived class is first converted to
+// the class that declares the field.
+func (c *Context) fieldAddress(object value.Value, field *Symbol) value.Value {
+	st := c.compiler.classTypes[field.classNode.className]
+	object = c.coerce(object, types.NewPointer(st))
+	return c.NewGetElementPtr(st, object, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(field.slot+1)))
+}
+
+// compileObject computes an expression that holds an object. Fields of a
+// class type that were never assigned hold no object, which stops the
+// program.
+func (c *Context) compileObject(exprNode ExprNode) value.Value {
+	object := c.compileExpr(exprNode)
+	c.NewCall(c.compiler.objectCheckFunc(), c.NewBitCast(object, types.I8Ptr), c.compiler.location(exprNode.span))
+	return object
+}
+
+// compileAddress returns a pointer to the variable or field an assignable
+// expression names.
+func (c *Context) compileAddress(exprNode ExprNode) value.Value {
+	switch exprNode.exprType {
+	case EXPR_MEMBER:
+		return c.fieldAddress(c.compileObject(*exprNode.memberNode.object), exprNode.memberNode.symbol)
+	case EXPR_INDEX:
+		container := c.compileExpr(*exprNode.indexNode.array)
+		index := c.compileExpr(*exprNode.indexNode.index)
+		return c.elementAddress(exprNode, container, index, false)
+	}
+	return c.vars[exprNode.termNode.symbol]
+}
+
+// elementAddress returns a pointer to the element of an array or the value
+// of a key in a map that `a[i]` names, once a and i are computed. Indexes
+// are checked against the length of the array. A missing key stops the
+// program, unless insert is set, in which case it is added to the map.
+func (c *Context) elementAddress(exprNode ExprNode, container value.Value, index value.Value, insert bool) value.Value {
+	location := c.compiler.location(exprNode.span)
+	containerType := exprNode.indexNode.array.valueType
+	if containerType.kind == TYPE_ARRAY {
+		c.NewCall(c.compiler.arrayCheckFunc(), container, index, location)
+		return c.elementPointer(container, index, exprNode.valueType)
+	}
+	key := c.toKey(index, containerType.key)
+	var slot value.Value
+	if insert {
+		slot = c.NewCall(c.compiler.mapFunc("map_find", key.Type()), container, key, constant.True, sizeOf(c.compiler.llvmType(containerType.elem)))
+	} else {
+		slot = c.NewCall(c.compiler.mapFunc("map_get", key.Type()), container, key, location)
+	}
+	return c.valuePointer(container, slot, containerType.elem)
+}
+
+// The fields of an array header.
+const (
+	arrayLength = iota
+	arrayCapacity
+	arrayData
+)
+
+func arrayField(b *ir.Block, arrayType types.Type, array value.Value, field int) value.Value {
+	return b.NewGetElementPtr(arrayType, array, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(field)))
+}
+
+// sizeOf is the size of a type: the offset of the second element of an array
+// of them.
+func sizeOf(t types.Type) constant.Constant {
+	end := constant.NewGetElementPtr(t, constant.NewNull(types.NewPointer(t)), constant.NewInt(types.I32, 1))
+	return constant.NewPtrToInt(end, types.I64)
+}
+
+// elementPointer returns a pointer to an element of an array without
+// checking the index.
+func (c *Context) elementPointer(array value.Value, index value.Value, elem *Type) value.Value {
+	elemType := c.compiler.llvmType(elem)
+	data := c.NewLoad(types.I8Ptr, arrayField(c.Block, c.compiler.arrayType, array, arrayData))
+	return c.NewGetElementPtr(elemType, c.NewBitCast(data, types.NewPointer(elemType)), index)
+}
+
+// valuePointer returns a pointer to the value in a slot of a map.
+func (c *Context) valuePointer(m value.Value, slot value.Value, elem *Type) value.Value {
+	elemType := c.compiler.llvmType(elem)
+	values := c.NewLoad(types.I8Ptr, mapField(c.Block, c.compiler.mapType, m, mapValues))
+	return c.NewGetElementPtr(elemType, c.NewBitCast(values, types.NewPointer(elemType)), slot)
+}
+
+// keyType is the type maps store keys of type t as. Bools are widened to
+// ints so that they share the helpers of int keys.
+func (c *Compiler) keyType(t *Type) types.Type {
+	if t.kind == TYPE_BOOL {
+		return types.I32
+	}
+	return c.llvmType(t)
+}
+
+func (c *Context) toKey(v value.Value, t *Type) value.Value {
+	if t.kind == TYPE_BOOL {
+		return c.NewZExt(v, types.I32)
+	}
+	return v
+}
+
+func (c *Context) fromKey(v value.Value, t *Type) value.Value {
+	if t.kind == TYPE_BOOL {
+		return c.NewTrunc(v, types.I1)
+	}
+	return v
+}
+
+func (c *Context) newMap(t *Type) value.Value {
+	return c.NewCall(c.compiler.mapNewFunc(), sizeOf(c.compiler.keyType(t.key)), sizeOf(c.compiler.llvmType(t.elem)))
+}
+
+// compileMap allocates the map of a literal and adds its keys in order, so
+// that a repeated key keeps its last value.
+func (c *Context) compileMap(exprNode ExprNode) value.Value {
+	t := exprNode.valueType
+	m := c.newMap(t)
+	termNode := exprNode.termNode
+	for i := range termNode.elements {
+		key := c.toKey(c.compileExpr(termNode.elements[i]), t.key)
+		v := c.compileExpr(termNode.values[i])
+		slot := c.NewCall(c.compiler.mapFunc("map_find", key.Type()), m, key, constant.True, sizeOf(c.compiler.llvmType(t.elem)))
+		c.store(v, c.valuePointer(m, slot, t.elem))
+	}
+	return m
+}
+
+func (c *Context) newArray(length int, elem *Type) value.Value {
+	return c.NewCall(c.compiler.arrayNewFunc(), constant.NewInt(types.I32, int64(length)), sizeOf(c.compiler.llvmType(elem)))
+}
+
+// compileArray allocates the array of a literal and stores its elements.
+func (c *Context) compileArray(exprNode ExprNode) value.Value {
+	elem := exprNode.valueType.elem
+	array := c.newArray(len(exprNode.termNode.elements), elem)
+	for i, element := range exprNode.termNode.elements {
+		c.store(c.compileExpr(element), c.elementPointer(array, constant.NewInt(types.I32, int64(i)), elem))
+	}
+	return array
+}
+
+// zeroValue is the value of variables and fields declared without one. A
+// fixed array gets its full length, and fixed arrays of arrays get a fresh
+// array for every element.
+func (c *Context) zeroValue(t *Type) value.Value {
+	if t.kind == TYPE_MAP {
+		return c.newMap(t)
+	}
+	if t.kind != TYPE_ARRAY {
+		return constant.NewZeroInitializer(c.compiler.llvmType(t))
+	}
+	if t.length == growable {
+		return c.newArray(0, t.elem)
+	}
+	array := c.newArray(t.length, t.elem)
+	if t.elem.kind != TYPE_ARRAY {
+		return array
+	}
+	f := c.Parent
+	counter := c.newAlloca(types.I32)
+	c.NewStore(constant.NewInt(types.I32, 0), counter)
+	condBlock := f.NewBlock("")
+	bodyBlock := f.NewBlock("")
+	leaveBlock := f.NewBlock("")
+	c.NewBr(condBlock)
+	c.Block = condBlock
+	i := c.NewLoad(types.I32, counter)
+	c.NewCondBr(c.NewICmp(enum.IPredSLT, i, constant.NewInt(types.I32, int64(t.length))), bodyBlock, leaveBlock)
+
+	c.Block = bodyBlock
+	c.NewStore(c.zeroValue(t.elem), c.elementPointer(array, i, t.elem))
+	c.NewStore(c.NewAdd(i, constant.NewInt(types.I32, 1)), counter)
+	c.NewBr(condBlock)
+
+	c.Block = leaveBlock
+	return array
+}
+
+func (c *Context) compileBuiltin(callNode CallNode) value.Value {
+	switch callNode.methodName {
+	case "len":
+		v := c.compileExpr(callNode.arguments[0])
+		switch callNode.arguments[0].valueType.kind {
+		case TYPE_ARRAY:
+			return c.NewLoad(types.I32, arrayField(c.Block, c.compiler.arrayType, v, arrayLength))
+		case TYPE_MAP:
+			return c.NewLoad(types.I32, mapField(c.Block, c.compiler.mapType, v, mapCount))
+		}
+		return c.NewExtractValue(v, 1)
+	case "push":
+		array := c.compileExpr(callNode.arguments[0])
+		elem := callNode.arguments[0].valueType.elem
+		v := c.compileExpr(callNode.arguments[1])
+		c.NewCall(c.compiler.arrayReserveFunc(), array, sizeOf(c.compiler.llvmType(elem)))
+		lengthField := arrayField(c.Block, c.compiler.arrayType, array, arrayLength)
+		length := c.NewLoad(types.I32, lengthField)
+		c.store(v, c.elementPointer(array, length, elem))
+		c.NewStore(c.NewAdd(length, constant.NewInt(types.I32, 1)), lengthField)
+		return nil
+	case "delete", "contains":
+		m := c.compileExpr(callNode.arguments[0])
+		key := c.toKey(c.compileExpr(callNode.arguments[1]), callNode.arguments[0].valueType.key)
+		if callNode.methodName == "delete" {
+			c.NewCall(c.compiler.mapFunc("map_delete", key.Type()), m, key)
+			return nil
+		}
+		slot := c.NewCall(c.compiler.mapFunc("map_find", key.Type()), m, key, constant.False, constant.NewInt(types.I64, 0))
+		return c.NewICmp(enum.IPredSGE, slot, constant.NewInt(types.I32, 0))
+	}
+	panic("Unknown builtin")
+}
+
+// compilePrint prints a value followed by a newline using the printf format
+// that matches its type.
+func (c *Context) compilePrint(printNode PrintNode) {
+	v := c.compileExpr(printNode.exprNode)
+	switch printNode.exprNode.valueType.kind {
+	case TYPE_INT:
+		c.NewCall(c.getFunc("printf"), stringPointer(c.getGlobal("printIntegerFormat")), v)
+		return
+	case TYPE_BOOL:
+		v = c.NewSelect(v, c.compiler.stringLiteral("true"), c.compiler.stringLiteral("false"))
+	}
+	c.NewCall(c.getFunc("printf"), stringPointer(c.getGlobal("printStringFormat")), c.NewExtractValue(v, 1), c.NewExtractValue(v, 0))
+}
+
 func (c Context) getMethodParams(methodNode MethodNode) []*ir.Param {
 	params := []*ir.Param{}
-	for name, typeName := range methodNode.parameters {
-		params = append(params, ir.NewParam(name, c.getTypeFromName(typeName)))
+	if methodNode.self != nil {
+		params = append(params, ir.NewParam("self", c.compiler.llvmType(methodNode.self.valueType)))
+	}
+	for _, paramNode := range methodNode.parameters {
+		params = append(params, ir.NewParam(paramNode.name, c.compiler.llvmType(paramNode.symbol.valueType)))
 	}
 	return params
 }
 
-func (c Context) getTypeFromName(typeName string) types.Type {
-	switch typeName {
-	case "int":
+func (c *Compiler) llvmType(t *Type) types.Type {
+	switch t.kind {
+	case TYPE_INT:
 		return types.I32
-	default:
-		// TODO check custom types
+	case TYPE_BOOL:
+		return types.I1
+	case TYPE_STRING:
+		return c.stringType
+	case TYPE_CLASS:
+		return types.NewPointer(c.classTypes[t.name])
+	case TYPE_INTERFACE:
+		return c.interfaceTypes[t.name]
+	case TYPE_ARRAY:
+		return types.NewPointer(c.arrayType)
+	case TYPE_MAP:
+		return types.NewPointer(c.mapType)
 	}
 	return types.Void
 }
 
-func (c *Context) getPrintfFunc() *ir.Func {
-	for _, fun := range c.compiler.module.Funcs {
-		if fun.GlobalName == "printf" {
-			return fun
-		}
+// stringPointer is a pointer to the first character of a string global.
+func stringPointer(global *ir.Global) constant.Constant {
+	zero := constant.NewInt(types.I32, 0)
+	return constant.NewGetElementPtr(global.ContentType, global, zero, zero)
+}
+
+// stringLiteral returns a constant string whose characters live in a
+// private global. Equal literals share the same global.
+func (c *Compiler) stringLiteral(s string) constant.Constant {
+	if literal, ok := c.literals[s]; ok {
+		return literal
 	}
-	panic("Couldn't find prinf function")
+	global := c.module.NewGlobalDef(fmt.Sprintf(".str.%d", len(c.literals)), constant.NewCharArrayFromString(s))
+	global.Linkage = enum.LinkagePrivate
+	global.UnnamedAddr = enum.UnnamedAddrUnnamedAddr
+	global.Immutable = true
+	literal := constant.NewStruct(c.stringType.(*types.StructType), stringPointer(global), constant.NewInt(types.I32, int64(len(s))))
+	c.literals[s] = literal
+	return literal
 }
 
-func (c Context) getPrintIntegerFormat() *ir.Global {
-	for _, gl := range c.compiler.module.Globals {
-		if gl.GlobalName == "printIntegerFormat" {
-			return gl
-		}
+// location is the `file:line:column` that runtime errors about the code at
+// span start with.
+func (c *Compiler) location(span Span) constant.Constant {
+	return c.stringLiteral(fmt.Sprintf("%s:%s", c.programNode.fileName, span.start))
+}
+
+// compileConcat copies both strings into a new heap buffer. Strings are
+// never freed.
+func (c *Context) compileConcat(l value.Value, r value.Value) value.Value {
+	lhsLength := c.NewExtractValue(l, 1)
+	rhsLength := c.NewExtractValue(r, 1)
+	length := c.NewAdd(lhsLength, rhsLength)
+	buffer := c.NewCall(c.getFunc("malloc"), c.NewSExt(length, types.I64))
+	c.NewCall(c.getFunc("memcpy"), buffer, c.NewExtractValue(l, 0), c.NewSExt(lhsLength, types.I64))
+	rest := c.NewGetElementPtr(types.I8, buffer, lhsLength)
+	c.NewCall(c.getFunc("memcpy"), rest, c.NewExtractValue(r, 0), c.NewSExt(rhsLength, types.I64))
+	s := c.NewInsertValue(constant.NewUndef(c.compiler.stringType), buffer, 0)
+	return c.NewInsertValue(s, length, 1)
+}
+
+// compileStringEqual compares lengths first and only compares as many bytes
+// as the strings have when the lengths match.
+func (c *Context) compileStringEqual(l value.Value, r value.Value) value.Value {
+	lhsLength := c.NewExtractValue(l, 1)
+	sameLength := c.NewICmp(enum.IPredEQ, lhsLength, c.NewExtractValue(r, 1))
+	n := c.NewSelect(sameLength, lhsLength, constant.NewInt(types.I32, 0))
+	cmp := c.NewCall(c.getFunc("memcmp"), c.NewExtractValue(l, 0), c.NewExtractValue(r, 0), c.NewSExt(n, types.I64))
+	return c.NewAnd(sameLength, c.NewICmp(enum.IPredEQ, cmp, constant.NewInt(types.I32, 0)))
+}
+
+func (c *Context) getFunc(name string) *ir.Func {
+	if fun := c.compiler.findFunc(name); fun != nil {
+		return fun
 	}
-	panic("Couldn't find printIntegerFormat global")
+	panic("Couldn't find " + name + " function")
 }
 
-func (c *Context) compileRel(relNode RelNode) value.Value {
-	switch relNode.relType {
-	case REL_LESS_THAN:
-		l := c.compileTerm(relNode.termBinaryNode.lhs)
-		r := c.compileTerm(relNode.termBinaryNode.rhs)
-		return c.NewICmp(enum.IPredSLT, l, r)
+func (c Context) getGlobal(name string) *ir.Global {
+	if global := c.compiler.findGlobal(name); global != nil {
+		return global
 	}
-	panic("Unimplemented Relational")
+	panic("Couldn't find " + name + " global")
+}
+
+var comparisonPredicates = map[ExprType]enum.IPred{
+	EXPR_LESS_THAN:          enum.IPredSLT,
+	EXPR_GREATER_THAN:       enum.IPredSGT,
+	EXPR_LESS_THAN_EQUAL:    enum.IPredSLE,
+	EXPR_GREATER_THAN_EQUAL: enum.IPredSGE,
+	EXPR_EQUAL:              enum.IPredEQ,
+	EXPR_NOT_EQUAL:          enum.IPredNE,
+}
+
+// compileLogical lowers && and || with short-circuit evaluation: the right
+// operand is only evaluated when the left one does not decide the result.
+func (c *Context) compileLogical(exprNode ExprNode) value.Value {
+	f := c.Parent
+	l := c.compileExpr(*exprNode.exprBinaryNode.lhs)
+	lhsBlock := c.Block
+	rhsBlock := f.NewBlock("")
+	leaveBlock := f.NewBlock("")
+	shortCircuit := constant.False
+	if exprNode.exprType == EXPR_AND {
+		c.NewCondBr(l, rhsBlock, leaveBlock)
+	} else {
+		shortCircuit = constant.True
+		c.NewCondBr(l, leaveBlock, rhsBlock)
+	}
+
+	c.Block = rhsBlock
+	r := c.compileExpr(*exprNode.exprBinaryNode.rhs)
+	c.NewBr(leaveBlock)
+
+	rhsEndBlock := c.Block
+	c.Block = leaveBlock
+	return c.NewPhi(ir.NewIncoming(shortCircuit, lhsBlock), ir.NewIncoming(r, rhsEndBlock))
 }
 
 func (c *Context) compileTerm(termNode TermNode) value.Value {
 	switch termNode.termType {
 	case TERM_INT:
-		value, _ := strconv.ParseInt(termNode.value, 10, 32)
-		return constant.NewInt(types.I32, value)
+		// The parser reports literals that do not fit in an int, except for
+		// the 2147483648 of -2147483648, which wraps around to the smallest
+		// int and stays there once negated.
+		value, _ := strconv.ParseInt(termNode.value, 10, 64)
+		return constant.NewInt(types.I32, int64(int32(value)))
+	case TERM_BOOL:
+		return constant.NewBool(termNode.value == "true")
+	case TERM_STRING:
+		return c.compiler.stringLiteral(termNode.value)
 	case TERM_IDENT:
-		return c.NewLoad(types.I32, c.lookupVariable(termNode.value))
+		slot := c.vars[termNode.symbol]
+		return c.NewLoad(slot.ElemType, slot)
+	case TERM_CALL:
+		return c.compileCall(termNode.callNode)
+	case TERM_INPUT:
+		if termNode.value == "string" {
+			return c.NewCall(c.compiler.inputLineFunc())
+		}
+		return c.NewCall(c.compiler.inputIntFunc())
 	}
 
 	panic("Unknown Term")
 }
 
-func (c *Context) lookupVariable(name string) value.Value {
-	if v, ok := c.vars[name]; ok {
-		return v
-	} else if c.parent != nil {
-		return c.parent.lookupVariable(name)
-	} else {
-		fmt.Printf("variable `%s`\n", name)
-		panic("no such variable")
-	}
-}
-
 func (c *Context) compileExpr(exprNode ExprNode) value.Value {
 	switch exprNode.exprType {
 	case EXPR_TERM:
+		if exprNode.isArrayLiteral() {
+			return c.compileArray(exprNode)
+		}
+		if exprNode.isMapLiteral() {
+			return c.compileMap(exprNode)
+		}
 		return c.compileTerm(exprNode.termNode)
+	case EXPR_NEGATE:
+		return c.NewSub(constant.NewInt(types.I32, 0), c.compileExpr(*exprNode.exprUnaryNode.operand))
+	case EXPR_NOT:
+		return c.NewXor(c.compileExpr(*exprNode.exprUnaryNode.operand), constant.True)
+	case EXPR_AND, EXPR_OR:
+		return c.compileLogical(exprNode)
+	case EXPR_MEMBER, EXPR_INDEX:
+		address := c.compileAddress(exprNode)
+		return c.NewLoad(c.compiler.llvmType(exprNode.valueType), address)
+	case EXPR_MEMBER_CALL:
+		return c.compileDispatch(exprNode.memberNode)
+	}
+
+	l := c.compileExpr(*exprNode.exprBinaryNode.lhs)
+	r := c.compileExpr(*exprNode.exprBinaryNode.rhs)
+	return c.compileBinary(exprNode.exprType, exprNode.exprBinaryNode.lhs.valueType, l, r, exprNode.span)
+}
+
+// compileBinary applies an arithmetic or comparison operator to operands
+// whose type is operandType. A division without an int result stops the
+// program with an error pointing at span.
+func (c *Context) compileBinary(exprType ExprType, operandType *Type, l value.Value, r value.Value, span Span) value.Value {
+	if operandType.kind == TYPE_CLASS || operandType.kind == TYPE_INTERFACE {
+		l, r = c.objectPointer(l), c.objectPointer(r)
+	}
+	if operandType.kind == TYPE_STRING {
+		switch exprType {
+		case EXPR_PLUS:
+			return c.compileConcat(l, r)
+		case EXPR_EQUAL:
+			return c.compileStringEqual(l, r)
+		case EXPR_NOT_EQUAL:
+			return c.NewXor(c.compileStringEqual(l, r), constant.True)
+		}
+	}
+	if predicate, ok := comparisonPredicates[exprType]; ok {
+		return c.NewICmp(predicate, l, r)
+	}
+	switch exprType {
 	case EXPR_PLUS:
-		l := c.compileTerm(exprNode.termBinaryNode.lhs)
-		r := c.compileTerm(exprNode.termBinaryNode.rhs)
 		return c.NewAdd(l, r)
+	case EXPR_MINUS:
+		return c.NewSub(l, r)
+	case EXPR_MULTIPLY:
+		return c.NewMul(l, r)
+	case EXPR_DIVIDE:
+		c.NewCall(c.compiler.divideCheckFunc(), l, r, c.compiler.location(span))
+		return c.NewSDiv(l, r)
+	case EXPR_MODULO:
+		c.NewCall(c.compiler.divideCheckFunc(), l, r, c.compiler.location(span))
+		return c.NewSRem(l, r)
 	}
 
 	panic("Unknown Expression")
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Runtime helpers are written straight into the module the first time a
+// program needs them. They are named yeol.rt.<name> and the functions of the
+// C library keep their own names. Methods of the program are all named
+// yeol.m.<name>, so neither can clash with them.
+
+func (c *Compiler) findFunc(name string) *ir.Func {
+	for _, fun := range c.module.Funcs {
+		if fun.GlobalName == name {
+			return fun
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) findGlobal(name string) *ir.Global {
+	for _, global := range c.module.Globals {
+		if global.GlobalName == name {
+			return global
+		}
+	}
+	return nil
+}
+
+// inputLineFunc returns a helper that reads a line from stdin with getline
+// and returns it without its newline. At the end of input it returns the
+// empty string.
+func (c *Compiler) inputLineFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.input_line"); fnc != nil {
+		return fnc
+	}
+	stdin := c.module.NewGlobal("stdin", types.I8Ptr)
+	stdin.Linkage = enum.LinkageExternal
+	getline := c.module.NewFunc("getline", types.I64,
+		ir.NewParam("lineptr", types.NewPointer(types.I8Ptr)), ir.NewParam("n", types.I64Ptr), ir.NewParam("stream", types.I8Ptr))
+
+	fnc := c.module.NewFunc("yeol.rt.input_line", c.stringType)
+	entry := fnc.NewBlock("")
+	eof := fnc.NewBlock("")
+	line := fnc.NewBlock("")
+
+	buffer := entry.NewAlloca(types.I8Ptr)
+	entry.NewStore(constant.NewNull(types.I8Ptr), buffer)
+	capacity := entry.NewAlloca(types.I64)
+	entry.NewStore(constant.NewInt(types.I64, 0), capacity)
+	n := entry.NewCall(getline, buffer, capacity, entry.NewLoad(types.I8Ptr, stdin))
+	entry.NewCondBr(entry.NewICmp(enum.IPredSLE, n, constant.NewInt(types.I64, 0)), eof, line)
+
+	eof.NewRet(c.stringLiteral(""))
+
+	characters := line.NewLoad(types.I8Ptr, buffer)
+	lastIndex := line.NewSub(n, constant.NewInt(types.I64, 1))
+	last := line.NewLoad(types.I8, line.NewGetElementPtr(types.I8, characters, lastIndex))
+	isNewline := line.NewICmp(enum.IPredEQ, last, constant.NewInt(types.I8, '\n'))
+	length := line.NewTrunc(line.NewSelect(isNewline, lastIndex, n), types.I32)
+	s := line.NewInsertValue(constant.NewUndef(c.stringType), characters, 0)
+	line.NewRet(line.NewInsertValue(s, length, 1))
+	return fnc
+}
+
+// inputIntFunc returns a helper that reads a line and parses the number at
+// its start with strtol. Text that is not a number and the end of input both
+// read as 0.
+func (c *Compiler) inputIntFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.input_int"); fnc != nil {
+		return fnc
+	}
+	inputLine := c.inputLineFunc()
+	strtol := c.module.NewFunc("strtol", types.I64,
+		ir.NewParam("nptr", types.I8Ptr), ir.NewParam("endptr", types.NewPointer(types.I8Ptr)), ir.NewParam("base", types.I32))
+
+	fnc := c.module.NewFunc("yeol.rt.input_int", types.I32)
+	entry := fnc.NewBlock("")
+	empty := fnc.NewBlock("")
+	number := fnc.NewBlock("")
+
+	s := entry.NewCall(inputLine)
+	isEmpty := entry.NewICmp(enum.IPredEQ, entry.NewExtractValue(s, 1), constant.NewInt(types.I32, 0))
+	entry.NewCondBr(isEmpty, empty, number)
+
+	empty.NewRet(constant.NewInt(types.I32, 0))
+
+	// getline leaves the line NUL terminated, so strtol stops in time.
+	v := number.NewCall(strtol, number.NewExtractValue(s, 0), constant.NewNull(types.NewPointer(types.I8Ptr)), constant.NewInt(types.I32, 10))
+	number.NewRet(number.NewTrunc(v, types.I32))
+	return fnc
+}
+
+// libcFunc declares a function of the C library unless the module already
+// has it. Methods never go by the name of a C function, so what it finds is
+// always the declaration of one.
+func (c *Compiler) libcFunc(name string, retType types.Type, params ...*ir.Param) *ir.Func {
+	if fnc := c.findFunc(name); fnc != nil {
+		return fnc
+	}
+	return c.module.NewFunc(name, retType, params...)
+}
+
+// arrayNewFunc returns a helper that allocates an array header and room for
+// length zeroed elements of the given size.
+func (c *Compiler) arrayNewFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.array_new"); fnc != nil {
+		return fnc
+	}
+	calloc := c.libcFunc("calloc", types.I8Ptr, ir.NewParam("nmemb", types.I64), ir.NewParam("size", types.I64))
+
+	length := ir.NewParam("length", types.I32)
+	elemSize := ir.NewParam("elem_size", types.I64)
+	fnc := c.module.NewFunc("yeol.rt.array_new", types.NewPointer(c.arrayType), length, elemSize)
+	entry := fnc.NewBlock("")
+	header := entry.NewBitCast(entry.NewCall(c.findFunc("malloc"), sizeOf(c.arrayType)), types.NewPointer(c.arrayType))
+	// calloc may return NULL for no elements, which is fine as nothing is
+	// read before the array grows.
+	data := entry.NewCall(calloc, entry.NewSExt(length, types.I64), elemSize)
+	entry.NewStore(length, arrayField(entry, c.arrayType, header, arrayLength))
+	entry.NewStore(length, arrayField(entry, c.arrayType, header, arrayCapacity))
+	entry.NewStore(data, arrayField(entry, c.arrayType, header, arrayData))
+	entry.NewRet(header)
+	return fnc
+}
+
+// arrayReserveFunc returns a helper that makes room for one more element,
+// doubling the capacity of a full array.
+func (c *Compiler) arrayReserveFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.array_reserve"); fnc != nil {
+		return fnc
+	}
+	realloc := c.libcFunc("realloc", types.I8Ptr, ir.NewParam("ptr", types.I8Ptr), ir.NewParam("size", types.I64))
+
+	array := ir.NewParam("array", types.NewPointer(c.arrayType))
+	elemSize := ir.NewParam("elem_size", types.I64)
+	fnc := c.module.NewFunc("yeol.rt.array_reserve", types.Void, array, elemSize)
+	entry := fnc.NewBlock("")
+	grow := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	length := entry.NewLoad(types.I32, arrayField(entry, c.arrayType, array, arrayLength))
+	capacityField := arrayField(entry, c.arrayType, array, arrayCapacity)
+	capacity := entry.NewLoad(types.I32, capacityField)
+	entry.NewCondBr(entry.NewICmp(enum.IPredSLT, length, capacity), done, grow)
+
+	doubled := grow.NewMul(capacity, constant.NewInt(types.I32, 2))
+	isSmall := grow.NewICmp(enum.IPredSLT, doubled, constant.NewInt(types.I32, 4))
+	newCapacity := grow.NewSelect(isSmall, constant.NewInt(types.I32, 4), doubled)
+	dataField := arrayField(grow, c.arrayType, array, arrayData)
+	size := grow.NewMul(grow.NewSExt(newCapacity, types.I64), elemSize)
+	grow.NewStore(grow.NewCall(realloc, grow.NewLoad(types.I8Ptr, dataField), size), dataField)
+	grow.NewStore(newCapacity, capacityField)
+	grow.NewBr(done)
+
+	done.NewRet(nil)
+	return fnc
+}
+
+// arrayCheckFunc returns a helper that stops the program with a message
+// naming the source location when an index is outside of an array.
+func (c *Compiler) arrayCheckFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.array_check"); fnc != nil {
+		return fnc
+	}
+	dprintf := c.libcFunc("dprintf", types.I32, ir.NewParam("fd", types.I32), ir.NewParam("format", types.I8Ptr))
+	dprintf.Sig.Variadic = true
+	exit := c.libcFunc("exit", types.Void, ir.NewParam("status", types.I32))
+	format := c.module.NewGlobalDef("yeol.rt.bounds_format", NewCString("%.*s: index %d is out of bounds for length %d\n"))
+	format.Linkage = enum.LinkagePrivate
+	format.Immutable = true
+
+	array := ir.NewParam("array", types.NewPointer(c.arrayType))
+	index := ir.NewParam("index", types.I32)
+	location := ir.NewParam("location", c.stringType)
+	fnc := c.module.NewFunc("yeol.rt.array_check", types.Void, array, index, location)
+	entry := fnc.NewBlock("")
+	fail := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	// Negative indexes are huge when compared unsigned, so one comparison
+	// covers both ends.
+	length := entry.NewLoad(types.I32, arrayField(entry, c.arrayType, array, arrayLength))
+	entry.NewCondBr(entry.NewICmp(enum.IPredULT, index, length), done, fail)
+
+	fail.NewCall(dprintf, constant.NewInt(types.I32, 2), stringPointer(format),
+		fail.NewExtractValue(location, 1), fail.NewExtractValue(location, 0), index, length)
+	fail.NewCall(exit, constant.NewInt(types.I32, 1))
+	fail.NewUnreachable()
+
+	done.NewRet(nil)
+	return fnc
+}
+
+// divideCheckFunc returns the function that stops the program when a
+// division has no int result: when the divisor is zero, or when the smallest
+// int is divided by -1, which overflows.
+func (c *Compiler) divideCheckFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.divide_check"); fnc != nil {
+		return fnc
+	}
+	dprintf := c.libcFunc("dprintf", types.I32, ir.NewParam("fd", types.I32), ir.NewParam("format", types.I8Ptr))
+	dprintf.Sig.Variadic = true
+	exit := c.libcFunc("exit", types.Void, ir.NewParam("status", types.I32))
+	zeroFormat := c.module.NewGlobalDef("yeol.rt.divide_format", NewCString("%.*s: division by zero\n"))
+	zeroFormat.Linkage = enum.LinkagePrivate
+	zeroFormat.Immutable = true
+	overflowFormat := c.module.NewGlobalDef("yeol.rt.overflow_format", NewCString("%.*s: integer overflow\n"))
+	overflowFormat.Linkage = enum.LinkagePrivate
+	overflowFormat.Immutable = true
+
+	dividend := ir.NewParam("dividend", types.I32)
+	divisor := ir.NewParam("divisor", types.I32)
+	location := ir.NewParam("location", c.stringType)
+	fnc := c.module.NewFunc("yeol.rt.divide_check", types.Void, dividend, divisor, location)
+	entry := fnc.NewBlock("")
+	zero := fnc.NewBlock("")
+	nonZero := fnc.NewBlock("")
+	overflow := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+	entry.NewCondBr(entry.NewICmp(enum.IPredEQ, divisor, constant.NewInt(types.I32, 0)), zero, nonZero)
+
+	isMinusOne := nonZero.NewICmp(enum.IPredEQ, divisor, constant.NewInt(types.I32, -1))
+	isMin := nonZero.NewICmp(enum.IPredEQ, dividend, constant.NewInt(types.I32, math.MinInt32))
+	nonZero.NewCondBr(nonZero.NewAnd(isMinusOne, isMin), overflow, done)
+
+	fail := func(b *ir.Block, format *ir.Global) {
+		b.NewCall(dprintf, constant.NewInt(types.I32, 2), stringPointer(format),
+			b.NewExtractValue(location, 1), b.NewExtractValue(location, 0))
+		b.NewCall(exit, constant.NewInt(types.I32, 1))
+		b.NewUnreachable()
+	}
+	fail(zero, zeroFormat)
+	fail(overflow, overflowFormat)
+
+	done.NewRet(nil)
+	return fnc
+}
+
+// objectCheckFunc returns the function that stops the program when an
+// object is used that was never assigned.
+func (c *Compiler) objectCheckFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.object_check"); fnc != nil {
+		return fnc
+	}
+	dprintf := c.libcFunc("dprintf", types.I32, ir.NewParam("fd", types.I32), ir.NewParam("format", types.I8Ptr))
+	dprintf.Sig.Variadic = true
+	exit := c.libcFunc("exit", types.Void, ir.NewParam("status", types.I32))
+	format := c.module.NewGlobalDef("yeol.rt.object_format", NewCString("%.*s: use of an object that was never assigned\n"))
+	format.Linkage = enum.LinkagePrivate
+	format.Immutable = true
+
+	object := ir.NewParam("object", types.I8Ptr)
+	location := ir.NewParam("location", c.stringType)
+	fnc := c.module.NewFunc("yeol.rt.object_check", types.Void, object, location)
+	entry := fnc.NewBlock("")
+	fail := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+	entry.NewCondBr(entry.NewICmp(enum.IPredEQ, object, constant.NewNull(types.I8Ptr)), fail, done)
+
+	fail.NewCall(dprintf, constant.NewInt(types.I32, 2), stringPointer(format),
+		fail.NewExtractValue(location, 1), fail.NewExtractValue(location, 0))
+	fail.NewCall(exit, constant.NewInt(types.I32, 1))
+	fail.NewUnreachable()
+
+	done.NewRet(nil)
+	return fnc
+}
+
+// The fields of a map header. Maps are hash tables with open addressing:
+// states holds one byte per slot, saying whether the slot is empty, holds a
+// key or held a key that was deleted. filled counts the slots that are not
+// empty, which bounds the length of every probe.
+const (
+	mapCount = iota
+	mapFilled
+	mapCapacity
+	mapStates
+	mapKeys
+	mapValues
+)
+
+const (
+	slotEmpty = iota
+	slotFull
+	slotDeleted
+)
+
+// mapInitialCapacity is the number of slots of a new map. Capacities stay
+// powers of two so that a hash is reduced to a slot with a mask.
+const mapInitialCapacity = 8
+
+// mapNewFunc returns a helper that allocates an empty map whose keys and
+// values have the given sizes.
+func (c *Compiler) mapNewFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.map_new"); fnc != nil {
+		return fnc
+	}
+	calloc := c.libcFunc("calloc", types.I8Ptr, ir.NewParam("nmemb", types.I64), ir.NewParam("size", types.I64))
+
+	keySize := ir.NewParam("key_size", types.I64)
+	valueSize := ir.NewParam("value_size", types.I64)
+	fnc := c.module.NewFunc("yeol.rt.map_new", types.NewPointer(c.mapType), keySize, valueSize)
+	entry := fnc.NewBlock("")
+	m := entry.NewBitCast(entry.NewCall(c.findFunc("malloc"), sizeOf(c.mapType)), types.NewPointer(c.mapType))
+	capacity := constant.NewInt(types.I64, mapInitialCapacity)
+	zero := constant.NewInt(types.I32, 0)
+	entry.NewStore(zero, mapField(entry, c.mapType, m, mapCount))
+	entry.NewStore(zero, mapField(entry, c.mapType, m, mapFilled))
+	entry.NewStore(constant.NewInt(types.I32, mapInitialCapacity), mapField(entry, c.mapType, m, mapCapacity))
+	entry.NewStore(entry.NewCall(calloc, capacity, constant.NewInt(types.I64, 1)), mapField(entry, c.mapType, m, mapStates))
+	entry.NewStore(entry.NewCall(calloc, capacity, keySize), mapField(entry, c.mapType, m, mapKeys))
+	entry.NewStore(entry.NewCall(calloc, capacity, valueSize), mapField(entry, c.mapType, m, mapValues))
+	entry.NewRet(m)
+	return fnc
+}
+
+func mapField(b *ir.Block, mapType types.Type, m value.Value, field int) value.Value {
+	return b.NewGetElementPtr(mapType, m, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(field)))
+}
+
+// mapFunc returns the helper called name for maps whose keys have the given
+// type: map_find, map_get or map_delete. Keys are either ints, which bools
+// are widened to, or strings. All helpers for a key type are written at once
+// since they call each other.
+func (c *Compiler) mapFunc(name string, keyType types.Type) *ir.Func {
+	suffix := "_int"
+	if keyType.Equal(c.stringType) {
+		suffix = "_string"
+	}
+	if fnc := c.findFunc("yeol.rt." + name + suffix); fnc != nil {
+		return fnc
+	}
+	c.defineMapFuncs(keyType, suffix)
+	return c.findFunc("yeol.rt." + name + suffix)
+}
+
+func (c *Compiler) defineMapFuncs(keyType types.Type, suffix string) {
+	mapPointer := types.NewPointer(c.mapType)
+	find := c.module.NewFunc("yeol.rt.map_find"+suffix, types.I32,
+		ir.NewParam("map", mapPointer), ir.NewParam("key", keyType), ir.NewParam("insert", types.I1), ir.NewParam("value_size", types.I64))
+	grow := c.module.NewFunc("yeol.rt.map_grow"+suffix, types.Void,
+		ir.NewParam("map", mapPointer), ir.NewParam("value_size", types.I64))
+	c.defineMapFind(find, grow)
+	c.defineMapGrow(grow, find)
+	c.defineMapGet(find)
+	c.defineMapDelete(find)
+}
+
+// defineMapFind writes the helper that returns the slot of a key, or -1 if
+// the map does not have it. With insert set, a missing key is added instead,
+// reusing the first deleted slot of its probe, and the map grows first if
+// it is three quarters full. The caller stores the value.
+func (c *Compiler) defineMapFind(fnc *ir.Func, grow *ir.Func) {
+	m, key, insert, valueSize := fnc.Params[0], fnc.Params[1], fnc.Params[2], fnc.Params[3]
+	keyType := key.Typ
+	entry := fnc.NewBlock("")
+	growBlock := fnc.NewBlock("")
+	start := fnc.NewBlock("")
+	loop := fnc.NewBlock("")
+	occupied := fnc.NewBlock("")
+	compare := fnc.NewBlock("")
+	found := fnc.NewBlock("")
+	advance := fnc.NewBlock("")
+	empty := fnc.NewBlock("")
+	missing := fnc.NewBlock("")
+	add := fnc.NewBlock("")
+
+	filledField := mapField(entry, c.mapType, m, mapFilled)
+	filled := entry.NewLoad(types.I32, filledField)
+	capacity := entry.NewLoad(types.I32, mapField(entry, c.mapType, m, mapCapacity))
+	load := entry.NewMul(entry.NewAdd(filled, constant.NewInt(types.I32, 1)), constant.NewInt(types.I32, 4))
+	full := entry.NewICmp(enum.IPredSGT, load, entry.NewMul(capacity, constant.NewInt(types.I32, 3)))
+	entry.NewCondBr(entry.NewAnd(insert, full), growBlock, start)
+
+	growBlock.NewCall(grow, m, valueSize)
+	growBlock.NewBr(start)
+
+	mask := start.NewSub(start.NewLoad(types.I32, mapField(start, c.mapType, m, mapCapacity)), constant.NewInt(types.I32, 1))
+	states := start.NewLoad(types.I8Ptr, mapField(start, c.mapType, m, mapStates))
+	keys := start.NewBitCast(start.NewLoad(types.I8Ptr, mapField(start, c.mapType, m, mapKeys)), types.NewPointer(keyType))
+	first := start.NewAnd(c.hashKey(start, key), mask)
+	start.NewBr(loop)
+
+	// tomb is the first deleted slot of the probe, or -1.
+	noSlot := constant.NewInt(types.I32, -1)
+	i := loop.NewPhi(ir.NewIncoming(first, start))
+	tomb := loop.NewPhi(ir.NewIncoming(noSlot, start))
+	stateField := loop.NewGetElementPtr(types.I8, states, i)
+	state := loop.NewLoad(types.I8, stateField)
+	isDeleted := loop.NewICmp(enum.IPredEQ, state, constant.NewInt(types.I8, slotDeleted))
+	isFirstDeleted := loop.NewAnd(isDeleted, loop.NewICmp(enum.IPredSLT, tomb, constant.NewInt(types.I32, 0)))
+	nextTomb := loop.NewSelect(isFirstDeleted, i, tomb)
+	loop.NewCondBr(loop.NewICmp(enum.IPredEQ, state, constant.NewInt(types.I8, slotEmpty)), empty, occupied)
+
+	occupied.NewCondBr(occupied.NewICmp(enum.IPredEQ, state, constant.NewInt(types.I8, slotFull)), compare, advance)
+
+	keyField := compare.NewGetElementPtr(keyType, keys, i)
+	compare.NewCondBr(c.keysEqual(compare, compare.NewLoad(keyType, keyField), key), found, advance)
+
+	found.NewRet(i)
+
+	next := advance.NewAnd(advance.NewAdd(i, constant.NewInt(types.I32, 1)), mask)
+	advance.NewBr(loop)
+	i.Incs = append(i.Incs, ir.NewIncoming(next, advance))
+	tomb.Incs = append(tomb.Incs, ir.NewIncoming(nextTomb, advance))
+
+	empty.NewCondBr(insert, add, missing)
+
+	missing.NewRet(noSlot)
+
+	reuse := add.NewICmp(enum.IPredSGE, tomb, constant.NewInt(types.I32, 0))
+	slot := add.NewSelect(reuse, tomb, i)
+	// filled is loaded again since growing resets it.
+	filled = add.NewLoad(types.I32, filledField)
+	add.NewStore(add.NewAdd(filled, add.NewZExt(add.NewXor(reuse, constant.True), types.I32)), filledField)
+	add.NewStore(constant.NewInt(types.I8, slotFull), add.NewGetElementPtr(types.I8, states, slot))
+	add.NewStore(key, add.NewGetElementPtr(keyType, keys, slot))
+	countField := mapField(add, c.mapType, m, mapCount)
+	add.NewStore(add.NewAdd(add.NewLoad(types.I32, countField), constant.NewInt(types.I32, 1)), countField)
+	add.NewRet(slot)
+}
+
+// defineMapGrow writes the helper that doubles the capacity of a map. The
+// keys are inserted again into fresh slots, which also drops the deleted
+// ones, and their values are copied along.
+func (c *Compiler) defineMapGrow(fnc *ir.Func, find *ir.Func) {
+	m, valueSize := fnc.Params[0], fnc.Params[1]
+	keyType := find.Params[1].Typ
+	calloc := c.findFunc("calloc")
+	memcpy := c.findFunc("memcpy")
+	entry := fnc.NewBlock("")
+	loop := fnc.NewBlock("")
+	body := fnc.NewBlock("")
+	move := fnc.NewBlock("")
+	next := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	capacityField := mapField(entry, c.mapType, m, mapCapacity)
+	statesField := mapField(entry, c.mapType, m, mapStates)
+	keysField := mapField(entry, c.mapType, m, mapKeys)
+	valuesField := mapField(entry, c.mapType, m, mapValues)
+	oldCapacity := entry.NewLoad(types.I32, capacityField)
+	oldStates := entry.NewLoad(types.I8Ptr, statesField)
+	oldKeys := entry.NewBitCast(entry.NewLoad(types.I8Ptr, keysField), types.NewPointer(keyType))
+	oldValues := entry.NewLoad(types.I8Ptr, valuesField)
+	newCapacity := entry.NewMul(oldCapacity, constant.NewInt(types.I32, 2))
+	n := entry.NewSExt(newCapacity, types.I64)
+	entry.NewStore(newCapacity, capacityField)
+	entry.NewStore(entry.NewCall(calloc, n, constant.NewInt(types.I64, 1)), statesField)
+	entry.NewStore(entry.NewCall(calloc, n, sizeOf(keyType)), keysField)
+	newValues := entry.NewCall(calloc, n, valueSize)
+	entry.NewStore(newValues, valuesField)
+	entry.NewStore(constant.NewInt(types.I32, 0), mapField(entry, c.mapType, m, mapCount))
+	entry.NewStore(constant.NewInt(types.I32, 0), mapField(entry, c.mapType, m, mapFilled))
+	entry.NewBr(loop)
+
+	i := loop.NewPhi(ir.NewIncoming(constant.NewInt(types.I32, 0), entry))
+	loop.NewCondBr(loop.NewICmp(enum.IPredSLT, i, oldCapacity), body, done)
+
+	state := body.NewLoad(types.I8, body.NewGetElementPtr(types.I8, oldStates, i))
+	body.NewCondBr(body.NewICmp(enum.IPredEQ, state, constant.NewInt(types.I8, slotFull)), move, next)
+
+	key := move.NewLoad(keyType, move.NewGetElementPtr(keyType, oldKeys, i))
+	slot := move.NewCall(find, m, key, constant.True, valueSize)
+	to := move.NewGetElementPtr(types.I8, newValues, move.NewMul(move.NewSExt(slot, types.I64), valueSize))
+	from := move.NewGetElementPtr(types.I8, oldValues, move.NewMul(move.NewSExt(i, types.I64), valueSize))
+	move.NewCall(memcpy, to, from, valueSize)
+	move.NewBr(next)
+
+	following := next.NewAdd(i, constant.NewInt(types.I32, 1))
+	next.NewBr(loop)
+	i.Incs = append(i.Incs, ir.NewIncoming(following, next))
+
+	done.NewRet(nil)
+}
+
+// defineMapGet writes the helper behind reading `m[key]`: it returns the
+// slot of the key and stops the program with a message naming the source
+// location if the map does not have it.
+func (c *Compiler) defineMapGet(find *ir.Func) {
+	dprintf := c.libcFunc("dprintf", types.I32, ir.NewParam("fd", types.I32), ir.NewParam("format", types.I8Ptr))
+	dprintf.Sig.Variadic = true
+	exit := c.libcFunc("exit", types.Void, ir.NewParam("status", types.I32))
+	format := c.findGlobal("yeol.rt.missing_key_format")
+	if format == nil {
+		format = c.module.NewGlobalDef("yeol.rt.missing_key_format", NewCString("%.*s: key not found in map\n"))
+		format.Linkage = enum.LinkagePrivate
+		format.Immutable = true
+	}
+
+	m := ir.NewParam("map", find.Params[0].Typ)
+	key := ir.NewParam("key", find.Params[1].Typ)
+	location := ir.NewParam("location", c.stringType)
+	fnc := c.module.NewFunc(strings.Replace(find.Name(), "find", "get", 1), types.I32, m, key, location)
+	entry := fnc.NewBlock("")
+	fail := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	slot := entry.NewCall(find, m, key, constant.False, constant.NewInt(types.I64, 0))
+	entry.NewCondBr(entry.NewICmp(enum.IPredSLT, slot, constant.NewInt(types.I32, 0)), fail, done)
+
+	fail.NewCall(dprintf, constant.NewInt(types.I32, 2), stringPointer(format), fail.NewExtractValue(location, 1), fail.NewExtractValue(location, 0))
+	fail.NewCall(exit, constant.NewInt(types.I32, 1))
+	fail.NewUnreachable()
+
+	done.NewRet(slot)
+}
+
+// defineMapDelete writes the helper that removes a key, if the map has it,
+// by marking its slot deleted so that probes still run past it.
+func (c *Compiler) defineMapDelete(find *ir.Func) {
+	m := ir.NewParam("map", find.Params[0].Typ)
+	key := ir.NewParam("key", find.Params[1].Typ)
+	fnc := c.module.NewFunc(strings.Replace(find.Name(), "find", "delete", 1), types.Void, m, key)
+	entry := fnc.NewBlock("")
+	remove := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	slot := entry.NewCall(find, m, key, constant.False, constant.NewInt(types.I64, 0))
+	entry.NewCondBr(entry.NewICmp(enum.IPredSLT, slot, constant.NewInt(types.I32, 0)), done, remove)
+
+	states := remove.NewLoad(types.I8Ptr, mapField(remove, c.mapType, m, mapStates))
+	remove.NewStore(constant.NewInt(types.I8, slotDeleted), remove.NewGetElementPtr(types.I8, states, slot))
+	countField := mapField(remove, c.mapType, m, mapCount)
+	remove.NewStore(remove.NewSub(remove.NewLoad(types.I32, countField), constant.NewInt(types.I32, 1)), countField)
+	remove.NewBr(done)
+
+	done.NewRet(nil)
+}
+
+// hashKey hashes a map key. Ints are mixed with a multiplicative hash and
+// strings are hashed with FNV-1a.
+func (c *Compiler) hashKey(b *ir.Block, key value.Value) value.Value {
+	if key.Type().Equal(c.stringType) {
+		return b.NewCall(c.stringHashFunc(), key)
+	}
+	h := b.NewMul(key, constant.NewInt(types.I32, -1640531535))
+	return b.NewXor(h, b.NewLShr(h, constant.NewInt(types.I32, 16)))
+}
+
+func (c *Compiler) keysEqual(b *ir.Block, l value.Value, r value.Value) value.Value {
+	if l.Type().Equal(c.stringType) {
+		ctx := newContext(b, c)
+		return ctx.compileStringEqual(l, r)
+	}
+	return b.NewICmp(enum.IPredEQ, l, r)
+}
+
+func (c *Compiler) stringHashFunc() *ir.Func {
+	if fnc := c.findFunc("yeol.rt.string_hash"); fnc != nil {
+		return fnc
+	}
+	s := ir.NewParam("s", c.stringType)
+	fnc := c.module.NewFunc("yeol.rt.string_hash", types.I32, s)
+	entry := fnc.NewBlock("")
+	loop := fnc.NewBlock("")
+	body := fnc.NewBlock("")
+	done := fnc.NewBlock("")
+
+	characters := entry.NewExtractValue(s, 0)
+	length := entry.NewExtractValue(s, 1)
+	entry.NewBr(loop)
+
+	i := loop.NewPhi(ir.NewIncoming(constant.NewInt(types.I32, 0), entry))
+	h := loop.NewPhi(ir.NewIncoming(constant.NewInt(types.I32, -2128831035), entry))
+	loop.NewCondBr(loop.NewICmp(enum.IPredSLT, i, length), body, done)
+
+	character := body.NewZExt(body.NewLoad(types.I8, body.NewGetElementPtr(types.I8, characters, i)), types.I32)
+	mixed := body.NewMul(body.NewXor(h, character), constant.NewInt(types.I32, 16777619))
+	following := body.NewAdd(i, constant.NewInt(types.I32, 1))
+	body.NewBr(loop)
+	i.Incs = append(i.Incs, ir.NewIncoming(following, body))
+	h.Incs = append(h.Incs, ir.NewIncoming(mixed, body))
+
+	done.NewRet(h)
+	return fnc
+}
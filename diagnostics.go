@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SEVERITY_ERROR   Severity = "error"
+	SEVERITY_WARNING Severity = "warning"
+)
+
+const (
+	ERR_INVALID_CHARACTER    = "E0100"
+	ERR_UNTERMINATED_STRING  = "E0101"
+	ERR_INVALID_ESCAPE       = "E0102"
+	ERR_UNEXPECTED_EOF       = "E0200"
+	ERR_UNEXPECTED_TOKEN     = "E0201"
+	ERR_UNKNOWN_TYPE         = "E0202"
+	ERR_OUTSIDE_LOOP         = "E0203"
+	ERR_DEFAULT_NOT_CONSTANT = "E0204"
+	ERR_DEFAULT_ORDER        = "E0205"
+	ERR_NOT_ASSIGNABLE       = "E0206"
+	ERR_INT_OUT_OF_RANGE     = "E0207"
+	ERR_UNKNOWN_VARIABLE     = "E0300"
+	ERR_REDECLARED           = "E0301"
+	ERR_UNKNOWN_METHOD       = "E0302"
+	ERR_ARGUMENT_COUNT       = "E0303"
+	ERR_TYPE_MISMATCH        = "E0304"
+	ERR_MISSING_RETURN       = "E0305"
+	ERR_NESTED_METHOD        = "E0306"
+	ERR_USE_BEFORE_DECLARE   = "E0307"
+	ERR_UNKNOWN_MEMBER       = "E0308"
+	ERR_INVALID_BASE         = "E0309"
+	ERR_BAD_OVERRIDE         = "E0310"
+	ERR_NOT_CONFORMING       = "E0311"
+	ERR_NOT_HASHABLE         = "E0312"
+	ERR_UNSUPPORTED          = "E0900"
+
+	WARN_SHADOWED = "W0300"
+)
+
+type Diagnostic struct {
+	severity Severity
+	code     string
+	message  string
+	span     Span
+}
+
+type Diagnostics struct {
+	fileName    string
+	source      string
+	diagnostics []Diagnostic
+}
+
+func newDiagnostics(fileName string, source string) *Diagnostics {
+	return &Diagnostics{fileName, source, []Diagnostic{}}
+}
+
+func (d *Diagnostics) report(severity Severity, span Span, code string, format string, args ...any) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{severity, code, fmt.Sprintf(format, args...), span})
+}
+
+func (d *Diagnostics) error(span Span, code string, format string, args ...any) {
+	d.report(SEVERITY_ERROR, span, code, format, args...)
+}
+
+func (d *Diagnostics) warning(span Span, code string, format string, args ...any) {
+	d.report(SEVERITY_WARNING, span, code, format, args...)
+}
+
+func (d *Diagnostics) hasErrors() bool {
+	for _, diagnostic := range d.diagnostics {
+		if diagnostic.severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Diagnostics) sourceLine(line int) string {
+	lines := strings.Split(d.source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
+
+// render formats a diagnostic as a header followed by the offending source
+// line with the span underlined by carets.
+func (d *Diagnostics) render(diagnostic Diagnostic) string {
+	var sb strings.Builder
+	start := diagnostic.span.start
+	end := diagnostic.span.end
+	sb.WriteString(fmt.Sprintf("%s:%s: %s[%s]: %s\n", d.fileName, start, diagnostic.severity, diagnostic.code, diagnostic.message))
+
+	line := d.sourceLine(start.line)
+	if line == "" {
+		return sb.String()
+	}
+	width := 1
+	if end.line == start.line && end.column > start.column {
+		width = end.column - start.column
+	} else if end.line > start.line {
+		width = max(len(line)-start.column+1, 1)
+	}
+	gutter := fmt.Sprintf("%d", start.line)
+	padding := strings.Repeat(" ", len(gutter))
+	var indent strings.Builder
+	for _, ch := range line[:min(start.column-1, len(line))] {
+		if ch == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	sb.WriteString(fmt.Sprintf(" %s | %s\n", gutter, line))
+	sb.WriteString(fmt.Sprintf(" %s | %s%s\n", padding, indent.String(), strings.Repeat("^", width)))
+	return sb.String()
+}
+
+func (d *Diagnostics) String() string {
+	var sb strings.Builder
+	for _, diagnostic := range d.diagnostics {
+		sb.WriteString(d.render(diagnostic))
+	}
+	return sb.String()
+}
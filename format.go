@@ -0,0 +1,302 @@
+package main
+
+import (
+	"strings"
+)
+
+// Formatter prints a parsed program back as source in the standard layout:
+// four spaces of indentation, one statement per line, single spaces around
+// binary operators and only the parentheses the precedence needs. Blank
+// lines between statements are kept, runs of them become one.
+type Formatter struct {
+	sb    strings.Builder
+	depth int
+}
+
+func newFormatter() *Formatter {
+	return &Formatter{}
+}
+
+func formatProgram(programNode ProgramNode) string {
+	f := newFormatter()
+	f.formatInstructions(programNode.instructions)
+	return f.sb.String()
+}
+
+func (f *Formatter) line(parts ...string) {
+	f.sb.WriteString(strings.Repeat("    ", f.depth))
+	for _, part := range parts {
+		f.sb.WriteString(part)
+	}
+	f.sb.WriteString("\n")
+}
+
+func (f *Formatter) formatInstructions(instructions []InstNode) {
+	for n, instNode := range instructions {
+		if n > 0 && instNode.span.start.line > instructions[n-1].span.end.line+1 {
+			f.sb.WriteString("\n")
+		}
+		f.formatInst(instNode)
+	}
+}
+
+// formatBlock writes the statements of a block and its closing brace; the
+// opening brace ends the line of the statement that owns the block.
+func (f *Formatter) formatBlock(blockNode BlockNode, closing string) {
+	f.depth++
+	f.formatInstructions(blockNode.instructions)
+	f.depth--
+	f.line(closing)
+}
+
+func (f *Formatter) formatInst(instNode InstNode) {
+	switch instNode.instType {
+	case INST_ASSIGN:
+		assignNode := instNode.assignNode
+		declaration := "let " + assignNode.identifier
+		if assignNode.typeName != "" {
+			declaration = "let " + assignNode.typeName + " " + assignNode.identifier
+		}
+		if assignNode.expr.exprType == "" {
+			f.line(declaration)
+		} else {
+			f.line(declaration, " = ", formatExpr(assignNode.expr))
+		}
+	case INST_REASSIGN:
+		reassignNode := instNode.reassignNode
+		operator := "="
+		if reassignNode.operator != "" {
+			operator = reassignNode.operator.spelling() + "="
+		}
+		f.line(formatStatementExpr(reassignNode.target), " ", operator, " ", formatExpr(reassignNode.expr))
+	case INST_IF:
+		ifNode := instNode.ifNode
+		f.line("if ", formatExpr(ifNode.condNode), " {")
+		if ifNode.elseBlockNode.span == (Span{}) {
+			f.formatBlock(ifNode.ifBlockNode, "}")
+		} else {
+			f.formatBlock(ifNode.ifBlockNode, "} else {")
+			f.formatBlock(ifNode.elseBlockNode, "}")
+		}
+	case INST_WHILE:
+		f.line("while ", formatExpr(instNode.whileNode.condNode), " {")
+		f.formatBlock(instNode.whileNode.blockNode, "}")
+	case INST_FOR:
+		forNode := instNode.forNode
+		if forNode.arrayNode.exprType != "" {
+			f.line("for ", forNode.identifier, " in ", formatExpr(forNode.arrayNode), " {")
+		} else {
+			f.line("for ", forNode.identifier, " in ", formatExpr(forNode.startNode), "..", formatExpr(forNode.endNode), " {")
+		}
+		f.formatBlock(forNode.blockNode, "}")
+	case INST_BREAK:
+		f.line("break")
+	case INST_CONTINUE:
+		f.line("continue")
+	case INST_PRINT:
+		f.line("print ", formatExpr(instNode.printNode.exprNode))
+	case INST_RETURN:
+		if instNode.returnNode.exprNode.exprType == "" {
+			f.line("return")
+		} else {
+			f.line("return ", formatExpr(instNode.returnNode.exprNode))
+		}
+	case INST_CALL:
+		f.line(formatStatementExpr(instNode.exprNode))
+	case INST_METHOD:
+		f.formatMethod(instNode.methodNode)
+	case INST_CLASS:
+		f.formatClass(instNode.classNode)
+	case INST_INTERFACE:
+		interfaceNode := instNode.interfaceNode
+		f.line("interface ", interfaceNode.name, " {")
+		f.depth++
+		for _, methodNode := range interfaceNode.methods {
+			f.line(formatSignature(methodNode))
+		}
+		f.depth--
+		f.line("}")
+	}
+}
+
+func (f *Formatter) formatMethod(methodNode MethodNode) {
+	f.line(formatSignature(methodNode), " {")
+	f.formatBlock(methodNode.blockNode, "}")
+}
+
+// formatClass writes the fields of a class before its methods, separated by
+// a blank line, the way they have to be read anyway.
+func (f *Formatter) formatClass(classNode ClassNode) {
+	header := "class " + classNode.className
+	if len(classNode.supertypes) > 0 {
+		header += ": " + strings.Join(classNode.supertypes, ", ")
+	}
+	f.line(header, " {")
+	f.depth++
+	for _, fieldNode := range classNode.fields {
+		declaration := "let " + fieldNode.name
+		if fieldNode.typeName != "" {
+			declaration = "let " + fieldNode.typeName + " " + fieldNode.name
+		}
+		if fieldNode.initializer == nil {
+			f.line(declaration)
+		} else {
+			f.line(declaration, " = ", formatExpr(*fieldNode.initializer))
+		}
+	}
+	for n, methodNode := range classNode.methods {
+		if n > 0 || len(classNode.fields) > 0 {
+			f.sb.WriteString("\n")
+		}
+		f.formatMethod(methodNode)
+	}
+	f.depth--
+	f.line("}")
+}
+
+func formatSignature(methodNode MethodNode) string {
+	parameters := make([]string, len(methodNode.parameters))
+	for n, paramNode := range methodNode.parameters {
+		parameters[n] = paramNode.name + ": " + paramNode.typeName
+		if paramNode.defaultValue != nil {
+			parameters[n] += " = " + formatExpr(*paramNode.defaultValue)
+		}
+	}
+	signature := "method " + methodNode.methodName + "(" + strings.Join(parameters, ", ") + ")"
+	if methodNode.returnType != "void" {
+		signature += ": " + methodNode.returnType
+	}
+	return signature
+}
+
+// precedence is how tightly an expression binds. Operands that bind less
+// tightly than the operator using them need parentheses.
+func precedence(exprNode ExprNode) int {
+	for _, operator := range binaryOperators {
+		if operator.exprType == exprNode.exprType {
+			return operator.precedence
+		}
+	}
+	switch exprNode.exprType {
+	case EXPR_NEGATE, EXPR_NOT:
+		return 6
+	}
+	return 7
+}
+
+func formatExpr(exprNode ExprNode) string {
+	switch exprNode.exprType {
+	case EXPR_TERM:
+		return formatTerm(exprNode.termNode)
+	case EXPR_NEGATE, EXPR_NOT:
+		operator := "-"
+		if exprNode.exprType == EXPR_NOT {
+			operator = "!"
+		}
+		// Nested unary operators get parentheses so that `- -x` does not
+		// come out as `--x`.
+		return operator + formatOperand(*exprNode.exprUnaryNode.operand, 7)
+	case EXPR_MEMBER:
+		return formatOperand(*exprNode.memberNode.object, 7) + "." + exprNode.memberNode.name
+	case EXPR_MEMBER_CALL:
+		memberNode := exprNode.memberNode
+		return formatOperand(*memberNode.object, 7) + "." + formatCall(memberNode.callNode)
+	case EXPR_INDEX:
+		indexNode := exprNode.indexNode
+		return formatOperand(*indexNode.array, 7) + "[" + formatExpr(*indexNode.index) + "]"
+	}
+	// Binary operators associate to the left, so an operand on the right
+	// with the same precedence needs parentheses.
+	p := precedence(exprNode)
+	binaryNode := exprNode.exprBinaryNode
+	return formatOperand(*binaryNode.lhs, p) + " " + exprNode.exprType.spelling() + " " + formatOperand(*binaryNode.rhs, p+1)
+}
+
+// formatStatementExpr formats the target of an assignment or a call made
+// as a statement. A statement starts with a name or a parenthesis, so any
+// other expression the target is built on keeps its parentheses.
+func formatStatementExpr(exprNode ExprNode) string {
+	switch exprNode.exprType {
+	case EXPR_MEMBER:
+		return formatStatementExpr(*exprNode.memberNode.object) + "." + exprNode.memberNode.name
+	case EXPR_MEMBER_CALL:
+		memberNode := exprNode.memberNode
+		return formatStatementExpr(*memberNode.object) + "." + formatCall(memberNode.callNode)
+	case EXPR_INDEX:
+		indexNode := exprNode.indexNode
+		return formatStatementExpr(*indexNode.array) + "[" + formatExpr(*indexNode.index) + "]"
+	case EXPR_TERM:
+		switch exprNode.termNode.termType {
+		case TERM_IDENT, TERM_CALL:
+			return formatTerm(exprNode.termNode)
+		}
+	}
+	return "(" + formatExpr(exprNode) + ")"
+}
+
+// formatOperand formats an expression used where only expressions binding
+// at least as tightly as minPrecedence can appear without parentheses.
+func formatOperand(exprNode ExprNode, minPrecedence int) string {
+	if precedence(exprNode) < minPrecedence {
+		return "(" + formatExpr(exprNode) + ")"
+	}
+	return formatExpr(exprNode)
+}
+
+func formatTerm(termNode TermNode) string {
+	switch termNode.termType {
+	case TERM_INPUT:
+		if termNode.value == "int" {
+			return "input"
+		}
+		return "input(" + termNode.value + ")"
+	case TERM_STRING:
+		return quoteString(termNode.value)
+	case TERM_CALL:
+		return formatCall(termNode.callNode)
+	case TERM_ARRAY:
+		return "[" + formatExprs(termNode.elements) + "]"
+	case TERM_MAP:
+		entries := make([]string, len(termNode.elements))
+		for n := range termNode.elements {
+			entries[n] = formatExpr(termNode.elements[n]) + ": " + formatExpr(termNode.values[n])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return termNode.value
+}
+
+func formatCall(callNode CallNode) string {
+	return callNode.methodName + "(" + formatExprs(callNode.arguments) + ")"
+}
+
+func formatExprs(exprNodes []ExprNode) string {
+	formatted := make([]string, len(exprNodes))
+	for n, exprNode := range exprNodes {
+		formatted[n] = formatExpr(exprNode)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// quoteString writes a string literal, escaping the bytes that have an
+// escape sequence.
+func quoteString(value string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		escaped := false
+		for escape, decoded := range escapeSequences {
+			if value[i] == decoded {
+				sb.WriteByte('\\')
+				sb.WriteByte(escape)
+				escaped = true
+				break
+			}
+		}
+		if !escaped {
+			sb.WriteByte(value[i])
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
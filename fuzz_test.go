@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// addSources seeds a fuzz target with the programs of testdata.
+func addSources(f *testing.F) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.yeol"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, source := range sources {
+		buffer, err := os.ReadFile(source)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(buffer))
+	}
+}
+
+// FuzzLexer checks that any input lexes into tokens whose spans lie inside
+// it, reporting what it cannot lex as diagnostics rather than panicking.
+func FuzzLexer(f *testing.F) {
+	addSources(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		diags := newDiagnostics("fuzz.yeol", source)
+		tokens := newLexer(source, diags).tokenize()
+		previous := 0
+		for _, token := range tokens {
+			start, end := token.span.start.offset, token.span.end.offset
+			if start < previous || end < start || end > len(source) {
+				t.Fatalf("%s spans %d to %d after offset %d of %d bytes", token.tokenType, start, end, previous, len(source))
+			}
+			previous = end
+		}
+		_ = diags.String()
+	})
+}
+
+// FuzzParser checks that any input parses, or fails with diagnostics, and
+// that a program that parses goes through the resolver and checker without
+// panicking. Programs without syntax errors must also survive formatting:
+// the formatted source parses again and formats the same way.
+func FuzzParser(f *testing.F) {
+	addSources(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		diags := newDiagnostics("fuzz.yeol", source)
+		tokens := newLexer(source, diags).tokenize()
+		p := newParser(tokens, diags)
+		programNode := p.parseProgram()
+		_ = diags.String()
+		if diags.hasErrors() {
+			return
+		}
+
+		formatted := formatProgram(programNode)
+		formattedDiags := newDiagnostics("formatted.yeol", formatted)
+		formattedTokens := newLexer(formatted, formattedDiags).tokenize()
+		formattedParser := newParser(formattedTokens, formattedDiags)
+		formattedProgram := formattedParser.parseProgram()
+		if formattedDiags.hasErrors() {
+			t.Fatalf("formatted program does not parse:\n%s\n%s", formatted, formattedDiags)
+		}
+		if again := formatProgram(formattedProgram); again != formatted {
+			t.Fatalf("formatting is not stable:\n%s\nformats as\n%s", formatted, again)
+		}
+
+		r := newResolver(diags)
+		r.resolveProgram(&programNode)
+		if diags.hasErrors() {
+			return
+		}
+		c := newChecker(diags)
+		c.checkProgram(&programNode)
+		_ = diags.String()
+		for _, format := range []AstFormat{AST_TREE, AST_SEXPR, AST_JSON} {
+			if _, err := formatProgramAst(programNode, format); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+// FuzzBackends runs generated programs with the interpreter and the LLVM
+// backend and checks that they print the same output.
+func FuzzBackends(f *testing.F) {
+	for seed := int64(1); seed <= 8; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		if tool := missingTool(BACKEND_LLVM); tool != "" {
+			t.Skipf("%s is not installed", tool)
+		}
+		source := newProgramGenerator(seed).program()
+		diags := newDiagnostics("generated.yeol", source)
+		programNode, ok := analyze(diags)
+		if !ok {
+			t.Fatalf("generated program does not check:\n%s", source)
+		}
+
+		var interpreted strings.Builder
+		status := newInterpreter(programNode, strings.NewReader(""), &interpreted).run()
+
+		text, err := generate(programNode, diags, BACKEND_LLVM)
+		if err != nil {
+			t.Fatalf("generated program does not compile:\n%s", source)
+		}
+		executable := filepath.Join(t.TempDir(), "generated")
+		if err := buildNative(text, BACKEND_LLVM, EMIT_EXE, "generated.yeol", executable); err != nil {
+			t.Fatal(err)
+		}
+		compiled := execute(t, exec.Command(executable), nil)
+		if compiled.stdout != interpreted.String() || compiled.status != status {
+			t.Fatalf("backends disagree on\n%s\n--- interpreter, status %d\n%s--- llvm, status %d\n%s%s",
+				source, status, interpreted.String(), compiled.status, compiled.stdout, compiled.stderr)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// programGenerator writes random programs that check, terminate and only do
+// what every backend does the same way. Loops run a bounded number of
+// times, divisors are kept away from 0 and -1, array indexes are wrapped
+// into range and methods only call methods declared before them.
+type programGenerator struct {
+	rand  *rand.Rand
+	sb    strings.Builder
+	depth int
+	// scopes holds the variables visible at each level of nesting. Loop
+	// counters are visible but not assignable.
+	scopes  [][]generatedVariable
+	methods []generatedMethod
+	// names counts the variables and methods declared so far, so that
+	// every name is new and nothing is shadowed.
+	names int
+}
+
+type generatedVariable struct {
+	name       string
+	typeName   string
+	assignable bool
+}
+
+type generatedMethod struct {
+	name       string
+	parameters []string
+	returnType string
+}
+
+var generatedTypes = []string{"int", "bool", "string", "[]int"}
+
+func newProgramGenerator(seed int64) *programGenerator {
+	return &programGenerator{rand: rand.New(rand.NewSource(seed)), scopes: [][]generatedVariable{{}}}
+}
+
+func (g *programGenerator) program() string {
+	for n := g.rand.Intn(3); n > 0; n-- {
+		g.method()
+	}
+	for n := 5 + g.rand.Intn(15); n > 0; n-- {
+		g.statement()
+	}
+	return g.sb.String()
+}
+
+func (g *programGenerator) line(format string, args ...any) {
+	g.sb.WriteString(strings.Repeat("    ", g.depth))
+	fmt.Fprintf(&g.sb, format, args...)
+	g.sb.WriteString("\n")
+}
+
+func (g *programGenerator) newName(prefix string) string {
+	g.names++
+	return fmt.Sprintf("%s%d", prefix, g.names)
+}
+
+func (g *programGenerator) declare(name string, typeName string, assignable bool) {
+	scope := &g.scopes[len(g.scopes)-1]
+	*scope = append(*scope, generatedVariable{name, typeName, assignable})
+}
+
+// variables lists the visible variables of a type, only the assignable ones
+// if assignable is set.
+func (g *programGenerator) variables(typeName string, assignable bool) []generatedVariable {
+	found := []generatedVariable{}
+	for _, scope := range g.scopes {
+		for _, variable := range scope {
+			if variable.typeName == typeName && (variable.assignable || !assignable) {
+				found = append(found, variable)
+			}
+		}
+	}
+	return found
+}
+
+// block writes the statements of a block and its closing brace.
+func (g *programGenerator) block(statements int, declare func()) {
+	g.depth++
+	g.scopes = append(g.scopes, []generatedVariable{})
+	if declare != nil {
+		declare()
+	}
+	for ; statements > 0; statements-- {
+		g.statement()
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.depth--
+	g.line("}")
+}
+
+func (g *programGenerator) method() {
+	method := generatedMethod{name: g.newName("m"), returnType: generatedTypes[g.rand.Intn(3)]}
+	parameters := []string{}
+	for n := g.rand.Intn(3); n > 0; n-- {
+		typeName := generatedTypes[g.rand.Intn(3)]
+		name := g.newName("p")
+		method.parameters = append(method.parameters, typeName)
+		parameters = append(parameters, name+": "+typeName)
+	}
+	g.line("method %s(%s): %s {", method.name, strings.Join(parameters, ", "), method.returnType)
+	// Methods see their parameters only.
+	scopes := g.scopes
+	g.scopes = [][]generatedVariable{{}}
+	g.depth++
+	for n, typeName := range method.parameters {
+		g.declare(strings.Split(parameters[n], ":")[0], typeName, true)
+	}
+	for n := 1 + g.rand.Intn(4); n > 0; n-- {
+		g.statement()
+	}
+	g.line("return %s", g.expr(method.returnType, 2))
+	g.depth--
+	g.line("}")
+	g.scopes = scopes
+	g.methods = append(g.methods, method)
+}
+
+func (g *programGenerator) statement() {
+	nested := g.depth < 3
+	switch choice := g.rand.Intn(10); {
+	case choice < 3:
+		typeName := generatedTypes[g.rand.Intn(len(generatedTypes))]
+		name := g.newName("v")
+		g.line("let %s %s = %s", typeName, name, g.expr(typeName, 3))
+		g.declare(name, typeName, true)
+	case choice < 5:
+		g.line("print %s", g.expr(generatedTypes[g.rand.Intn(3)], 3))
+	case choice == 5:
+		g.assign()
+	case choice == 6 && nested:
+		g.line("if %s {", g.expr("bool", 2))
+		if g.rand.Intn(2) == 0 {
+			g.depth++
+			g.scopes = append(g.scopes, []generatedVariable{})
+			for n := 1 + g.rand.Intn(3); n > 0; n-- {
+				g.statement()
+			}
+			g.scopes = g.scopes[:len(g.scopes)-1]
+			g.depth--
+			g.line("} else {")
+		}
+		g.block(1+g.rand.Intn(3), nil)
+	case choice == 7 && nested:
+		name := g.newName("i")
+		start := g.rand.Intn(5) - 2
+		g.line("for %s in %d..%d {", name, start, start+g.rand.Intn(5))
+		g.loop(func() { g.declare(name, "int", false) })
+	case choice == 8 && nested:
+		// The counter is declared outside the loop and only the loop
+		// changes it, so the loop ends.
+		counter := g.newName("w")
+		g.line("let int %s = 0", counter)
+		g.declare(counter, "int", false)
+		g.line("while %s < %d {", counter, 1+g.rand.Intn(4))
+		g.loop(func() { g.line("%s += 1", counter) })
+	case choice == 9 && len(g.variables("[]int", false)) > 0:
+		arrays := g.variables("[]int", false)
+		g.line("push(%s, %s)", arrays[g.rand.Intn(len(arrays))].name, g.expr("int", 2))
+	default:
+		g.line("print %s", g.expr("int", 3))
+	}
+}
+
+// loop writes the body of a loop, which sometimes leaves the loop early.
+func (g *programGenerator) loop(declare func()) {
+	g.block(1+g.rand.Intn(3), func() {
+		declare()
+		if g.rand.Intn(4) == 0 {
+			g.line("if %s {", g.expr("bool", 1))
+			g.line("    %s", []string{"break", "continue"}[g.rand.Intn(2)])
+			g.line("}")
+		}
+	})
+}
+
+func (g *programGenerator) assign() {
+	typeName := generatedTypes[g.rand.Intn(3)]
+	targets := g.variables(typeName, true)
+	if len(targets) == 0 {
+		g.line("print %s", g.expr(typeName, 2))
+		return
+	}
+	target := targets[g.rand.Intn(len(targets))].name
+	if typeName == "int" && g.rand.Intn(2) == 0 {
+		operator := []string{"+=", "-=", "*="}[g.rand.Intn(3)]
+		g.line("%s %s %s", target, operator, g.expr("int", 2))
+		return
+	}
+	g.line("%s = %s", target, g.expr(typeName, 3))
+}
+
+// expr writes an expression of a type, nesting at most depth operators.
+func (g *programGenerator) expr(typeName string, depth int) string {
+	variables := g.variables(typeName, false)
+	if depth == 0 || g.rand.Intn(4) == 0 {
+		if len(variables) > 0 && g.rand.Intn(2) == 0 {
+			return variables[g.rand.Intn(len(variables))].name
+		}
+		return g.literal(typeName)
+	}
+	if call := g.call(typeName, depth); call != "" && g.rand.Intn(4) == 0 {
+		return call
+	}
+	switch typeName {
+	case "int":
+		l, r := g.expr("int", depth-1), g.expr("int", depth-1)
+		switch choice := g.rand.Intn(9); choice {
+		case 0, 1, 2:
+			return fmt.Sprintf("(%s %s %s)", l, []string{"+", "-", "*"}[choice], r)
+		case 3:
+			// The divisor is between 2 and 14.
+			return fmt.Sprintf("(%s %s (%s %% 7 + 8))", l, []string{"/", "%"}[g.rand.Intn(2)], r)
+		case 4:
+			return "-(" + l + ")"
+		case 5:
+			return fmt.Sprintf("len(%s)", g.expr("string", depth-1))
+		case 6, 7:
+			arrays := g.variables("[]int", false)
+			if len(arrays) == 0 {
+				return l
+			}
+			array := arrays[g.rand.Intn(len(arrays))].name
+			if choice == 6 {
+				return fmt.Sprintf("len(%s)", array)
+			}
+			return fmt.Sprintf("%s[(%s %% len(%s) + len(%s)) %% len(%s)]", array, l, array, array, array)
+		}
+		return l
+	case "bool":
+		switch g.rand.Intn(5) {
+		case 0:
+			operator := []string{"<", ">", "<=", ">=", "==", "!="}[g.rand.Intn(6)]
+			return fmt.Sprintf("(%s %s %s)", g.expr("int", depth-1), operator, g.expr("int", depth-1))
+		case 1:
+			return fmt.Sprintf("(%s %s %s)", g.expr("string", depth-1), []string{"==", "!="}[g.rand.Intn(2)], g.expr("string", depth-1))
+		case 2:
+			return "!" + g.expr("bool", depth-1)
+		default:
+			return fmt.Sprintf("(%s %s %s)", g.expr("bool", depth-1), []string{"&&", "||"}[g.rand.Intn(2)], g.expr("bool", depth-1))
+		}
+	case "string":
+		// Appending only literals keeps strings from doubling in loops.
+		return fmt.Sprintf("(%s + %s)", g.expr("string", depth-1), g.literal("string"))
+	}
+	return g.literal(typeName)
+}
+
+func (g *programGenerator) literal(typeName string) string {
+	switch typeName {
+	case "int":
+		return []string{"0", "1", "2", "7", "42", "2147483647", "100000"}[g.rand.Intn(7)]
+	case "bool":
+		return []string{"true", "false"}[g.rand.Intn(2)]
+	case "string":
+		return []string{`""`, `"a"`, `"yeol"`, `"tab\t"`, `"\"q\""`}[g.rand.Intn(5)]
+	}
+	elements := []string{}
+	for n := 1 + g.rand.Intn(3); n > 0; n-- {
+		elements = append(elements, g.literal("int"))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// call writes a call to a method returning typeName, or nothing if there
+// is none.
+func (g *programGenerator) call(typeName string, depth int) string {
+	candidates := []generatedMethod{}
+	for _, method := range g.methods {
+		if method.returnType == typeName {
+			candidates = append(candidates, method)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	method := candidates[g.rand.Intn(len(candidates))]
+	arguments := make([]string, len(method.parameters))
+	for n, parameterType := range method.parameters {
+		arguments[n] = g.expr(parameterType, depth-1)
+	}
+	return method.name + "(" + strings.Join(arguments, ", ") + ")"
+}
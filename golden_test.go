@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The programs in testdata are run through yeol the way a user would run
+// them. Next to each name.yeol, name.stdin is what the program reads,
+// name.stdout and name.stderr what it prints, name.status its exit status
+// when it is not 0 and name.diagnostics what `yeol check` reports. A missing
+// file stands for an empty one. Every backend is compared against these
+// files, which -update rewrites from the output of the interpreter.
+var update = flag.Bool("update", false, "rewrite the expected output in testdata")
+
+// TestMain runs the test binary as yeol itself when the tests start it with
+// YEOL_TEST_MAIN set.
+func TestMain(m *testing.M) {
+	if os.Getenv("YEOL_TEST_MAIN") == "1" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+type result struct {
+	stdout string
+	stderr string
+	status int
+}
+
+func yeol(t *testing.T, stdin []byte, args ...string) result {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "YEOL_TEST_MAIN=1")
+	return execute(t, cmd, stdin)
+}
+
+// execute runs a command to its end and collects what it printed.
+func execute(t *testing.T, cmd *exec.Cmd, stdin []byte) result {
+	t.Helper()
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("running %s: %v", strings.Join(cmd.Args, " "), err)
+	}
+	return result{stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()}
+}
+
+// readGolden returns the content of an expected file, which is empty when
+// the file is missing.
+func readGolden(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// golden compares output with the file at path, or rewrites the file with
+// -update.
+func golden(t *testing.T, path string, output string) {
+	t.Helper()
+	if *update {
+		var err error
+		if output == "" {
+			err = os.Remove(path)
+		} else {
+			err = os.WriteFile(path, []byte(output), 0644)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+		return
+	}
+	want := readGolden(t, path)
+	if output != want {
+		t.Errorf("%s differs\n--- want\n%s--- got\n%s", path, want, output)
+	}
+}
+
+// statusText is the content of name.status for an exit status.
+func statusText(status int) string {
+	if status == exitSuccess {
+		return ""
+	}
+	return fmt.Sprintf("%d\n", status)
+}
+
+// expected reads what running the program at base.yeol should produce.
+func expected(t *testing.T, base string) result {
+	t.Helper()
+	want := result{stdout: readGolden(t, base+".stdout"), stderr: readGolden(t, base+".stderr")}
+	if status := readGolden(t, base+".status"); status != "" {
+		var err error
+		if want.status, err = strconv.Atoi(strings.TrimSpace(status)); err != nil {
+			t.Fatalf("%s.status: %v", base, err)
+		}
+	}
+	return want
+}
+
+// compare reports how the result of running a program with a backend
+// differs from what is expected of it.
+func compare(t *testing.T, backend Backend, base string, got result, want result) {
+	t.Helper()
+	if got.stdout != want.stdout {
+		t.Errorf("stdout differs from %s.stdout\n--- want\n%s--- %s\n%s", base, want.stdout, backend, got.stdout)
+	}
+	if got.stderr != want.stderr {
+		t.Errorf("stderr differs from %s.stderr\n--- want\n%s--- %s\n%s", base, want.stderr, backend, got.stderr)
+	}
+	if got.status != want.status {
+		t.Errorf("exit status is %d but %s.status expects %d", got.status, base, want.status)
+	}
+}
+
+// missingTool names a tool the backend needs that is not installed.
+func missingTool(backend Backend) string {
+	switch backend {
+	case BACKEND_LLVM:
+		if clangTool.find() == "" && llcTool.find() == "" {
+			return "clang or llc"
+		}
+		if clangTool.find() == "" && ccTool.find() == "" {
+			return ccTool.name
+		}
+	case BACKEND_NASM:
+		for _, tool := range []Tool{nasmTool, ldTool} {
+			if tool.find() == "" {
+				return tool.name
+			}
+		}
+	}
+	return ""
+}
+
+func TestGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.yeol"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		base := strings.TrimSuffix(source, ".yeol")
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			t.Parallel()
+			stdin, err := os.ReadFile(base + ".stdin")
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.Fatal(err)
+			}
+			check := yeol(t, nil, "check", source)
+			golden(t, base+".diagnostics", check.stderr)
+			if check.status != exitSuccess {
+				return
+			}
+
+			if *update {
+				interpreted := yeol(t, stdin, "run", source)
+				golden(t, base+".stdout", interpreted.stdout)
+				golden(t, base+".stderr", interpreted.stderr)
+				golden(t, base+".status", statusText(interpreted.status))
+			}
+			want := expected(t, base)
+			for _, backend := range []Backend{BACKEND_INTERP, BACKEND_LLVM, BACKEND_NASM} {
+				t.Run(string(backend), func(t *testing.T) {
+					if tool := missingTool(backend); tool != "" {
+						t.Skipf("%s is not installed", tool)
+					}
+					got := yeol(t, stdin, "run", "--backend="+string(backend), source)
+					if strings.Contains(got.stderr, "error["+ERR_UNSUPPORTED+"]") {
+						t.Skipf("the program uses what the %s backend does not support", backend)
+					}
+					compare(t, backend, base, got, want)
+				})
+			}
+		})
+	}
+}
+
+// TestAst compares each format of `yeol ast` with name.format next to the
+// programs in testdata/ast.
+func TestAst(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "ast", "*.yeol"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		base := strings.TrimSuffix(source, ".yeol")
+		for _, format := range []AstFormat{AST_TREE, AST_SEXPR, AST_JSON} {
+			t.Run(filepath.Base(base)+"/"+string(format), func(t *testing.T) {
+				ast := yeol(t, nil, "ast", "--format="+string(format), source)
+				if ast.status != exitSuccess {
+					t.Fatalf("yeol ast exits with %d\n%s", ast.status, ast.stderr)
+				}
+				golden(t, base+"."+string(format), ast.stdout)
+			})
+		}
+	}
+}
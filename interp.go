@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Interpreter runs a checked program by walking its tree. It follows the
+// semantics of the LLVM backend: ints are 32 bits wide and wrap around, and
+// runtime errors print the same messages.
+type Interpreter struct {
+	programNode ProgramNode
+	in          *bufio.Reader
+	out         *bufio.Writer
+	// frame holds the variables of the method being run, indexed by the
+	// slots of their symbols. method is nil at the top level.
+	frame  []any
+	method *MethodNode
+	// result is the value of the last return statement.
+	result any
+}
+
+// control tells the enclosing statements how a statement finished.
+type control int
+
+const (
+	controlNext control = iota
+	controlBreak
+	controlContinue
+	controlReturn
+)
+
+// runtimeError stops the program with a message, the way a failed check in
+// a compiled program does.
+type runtimeError struct {
+	message string
+}
+
+// exitProgram stops the program with a status, as a return at the top
+// level does.
+type exitProgram struct {
+	status int
+}
+
+func newInterpreter(programNode ProgramNode, in io.Reader, out io.Writer) *Interpreter {
+	return &Interpreter{
+		programNode: programNode,
+		in:          bufio.NewReader(in),
+		out:         bufio.NewWriter(out),
+	}
+}
+
+// run runs the program and returns its exit status. Runtime errors are
+// written to stderr.
+func (i *Interpreter) run() int {
+	i.frame = make([]any, i.programNode.locals)
+	status, _ := i.guard(func() {
+		i.runBlock(BlockNode{instructions: i.programNode.instructions})
+	})
+	return status
+}
+
+// guard runs f and writes the runtime error that stopped it, if any, to
+// stderr. It returns the exit status of the program and whether f ended it
+// with a return at the top level.
+func (i *Interpreter) guard(f func()) (status int, exited bool) {
+	defer i.out.Flush()
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case exitProgram:
+			status, exited = r.status, true
+		case runtimeError:
+			i.out.Flush()
+			fmt.Fprintln(os.Stderr, r.message)
+			status = 1
+		default:
+			panic(r)
+		}
+	}()
+	f()
+	return 0, false
+}
+
+func (i *Interpreter) fail(span Span, format string, args ...any) {
+	location := fmt.Sprintf("%s:%s", i.programNode.fileName, span.start)
+	panic(runtimeError{location + ": " + fmt.Sprintf(format, args...)})
+}
+
+func (i *Interpreter) runBlock(blockNode BlockNode) control {
+	for _, instNode := range blockNode.instructions {
+		if c := i.runInst(instNode); c != controlNext {
+			return c
+		}
+	}
+	return controlNext
+}
+
+func (i *Interpreter) runInst(instNode InstNode) control {
+	switch instNode.instType {
+	case INST_ASSIGN:
+		assignNode := instNode.assignNode
+		if assignNode.expr.exprType == "" {
+			i.frame[assignNode.symbol.slot] = zeroValue(assignNode.symbol.valueType)
+		} else {
+			i.frame[assignNode.symbol.slot] = i.eval(assignNode.expr)
+		}
+	case INST_REASSIGN:
+		i.runReassign(instNode.reassignNode)
+	case INST_IF:
+		if i.eval(instNode.ifNode.condNode).(bool) {
+			return i.runBlock(instNode.ifNode.ifBlockNode)
+		}
+		return i.runBlock(instNode.ifNode.elseBlockNode)
+	case INST_WHILE:
+		for i.eval(instNode.whileNode.condNode).(bool) {
+			if c := i.runBlock(instNode.whileNode.blockNode); c == controlBreak {
+				break
+			} else if c == controlReturn {
+				return c
+			}
+		}
+	case INST_FOR:
+		return i.runFor(instNode.forNode)
+	case INST_BREAK:
+		return controlBreak
+	case INST_CONTINUE:
+		return controlContinue
+	case INST_PRINT:
+		i.runPrint(instNode.printNode)
+	case INST_RETURN:
+		return i.runReturn(instNode.returnNode)
+	case INST_CALL:
+		i.eval(instNode.exprNode)
+	case INST_METHOD, INST_CLASS, INST_INTERFACE:
+		// Declarations were resolved ahead of time.
+	}
+	return controlNext
+}
+
+// runReassign assigns to a variable, field or element. Like in compiled
+// programs, the object or array and the index are computed before the value.
+func (i *Interpreter) runReassign(reassignNode ReassignNode) {
+	target := reassignNode.target
+	var load func() any
+	var store func(any)
+	switch target.exprType {
+	case EXPR_MEMBER:
+		o := i.objectOf(*target.memberNode.object)
+		slot := target.memberNode.symbol.slot
+		load = func() any { return o.fields[slot] }
+		store = func(v any) { o.fields[slot] = v }
+	case EXPR_INDEX:
+		container := i.eval(*target.indexNode.array)
+		index := i.eval(*target.indexNode.index)
+		load = func() any { return i.index(target, container, index) }
+		store = func(v any) { i.setIndex(target, container, index, v) }
+	default:
+		slot := target.termNode.symbol.slot
+		load = func() any { return i.frame[slot] }
+		store = func(v any) { i.frame[slot] = v }
+	}
+	v := i.eval(reassignNode.expr)
+	if reassignNode.operator != "" {
+		v = i.binary(reassignNode.operator, load(), v, reassignNode.span)
+	}
+	store(v)
+}
+
+// runFor runs a loop over a range, the elements of an array or the keys of
+// a map. The end of a range is computed once; arrays and maps are looked at
+// again on every iteration since the body may grow them.
+func (i *Interpreter) runFor(forNode ForNode) control {
+	slot := forNode.symbol.slot
+	var next func(n int) bool
+	if forNode.arrayNode.exprType == "" {
+		start := i.eval(forNode.startNode).(int32)
+		end := i.eval(forNode.endNode).(int32)
+		i.frame[slot] = start
+		next = func(n int) bool {
+			if n > 0 {
+				i.frame[slot] = i.frame[slot].(int32) + 1
+			}
+			return i.frame[slot].(int32) < end
+		}
+	} else {
+		switch container := i.eval(forNode.arrayNode).(type) {
+		case *array:
+			next = func(n int) bool {
+				if n >= len(container.elements) {
+					return false
+				}
+				i.frame[slot] = container.elements[n]
+				return true
+			}
+		case *hashMap:
+			position := 0
+			next = func(int) bool {
+				for ; position < len(container.states); position++ {
+					if container.states[position] == slotFull {
+						i.frame[slot] = container.keys[position]
+						position++
+						return true
+					}
+				}
+				return false
+			}
+		}
+	}
+	for n := 0; next(n); n++ {
+		if c := i.runBlock(forNode.blockNode); c == controlBreak {
+			break
+		} else if c == controlReturn {
+			return c
+		}
+	}
+	return controlNext
+}
+
+func (i *Interpreter) runPrint(printNode PrintNode) {
+	switch v := i.eval(printNode.exprNode).(type) {
+	case int32:
+		fmt.Fprintf(i.out, "%d\n", v)
+	case bool:
+		fmt.Fprintf(i.out, "%t\n", v)
+	case string:
+		fmt.Fprintf(i.out, "%s\n", v)
+	}
+}
+
+// runReturn returns from a method, or exits the program when it runs at the
+// top level.
+func (i *Interpreter) runReturn(returnNode ReturnNode) control {
+	i.result = nil
+	if returnNode.exprNode.exprType != "" {
+		i.result = i.eval(returnNode.exprNode)
+	}
+	if i.method == nil {
+		status := 0
+		if i.result != nil {
+			status = int(uint8(i.result.(int32)))
+		}
+		panic(exitProgram{status})
+	}
+	return controlReturn
+}
+
+func (i *Interpreter) eval(exprNode ExprNode) any {
+	switch exprNode.exprType {
+	case EXPR_TERM:
+		return i.evalTerm(exprNode)
+	case EXPR_NEGATE:
+		return -i.eval(*exprNode.exprUnaryNode.operand).(int32)
+	case EXPR_NOT:
+		return !i.eval(*exprNode.exprUnaryNode.operand).(bool)
+	case EXPR_AND:
+		return i.eval(*exprNode.exprBinaryNode.lhs).(bool) && i.eval(*exprNode.exprBinaryNode.rhs).(bool)
+	case EXPR_OR:
+		return i.eval(*exprNode.exprBinaryNode.lhs).(bool) || i.eval(*exprNode.exprBinaryNode.rhs).(bool)
+	case EXPR_MEMBER:
+		return i.objectOf(*exprNode.memberNode.object).fields[exprNode.memberNode.symbol.slot]
+	case EXPR_MEMBER_CALL:
+		memberNode := exprNode.memberNode
+		o := i.objectOf(*memberNode.object)
+		// Looking the method up by name in the class of the object finds
+		// the override that the vtable of the class would. Default values
+		// come from the method the call was checked against.
+		arguments, _ := memberNode.symbol.methodNode.bindArguments(memberNode.callNode.arguments)
+		return i.call(o.classNode.members[memberNode.name].methodNode, arguments, o)
+	case EXPR_INDEX:
+		return i.index(exprNode, i.eval(*exprNode.indexNode.array), i.eval(*exprNode.indexNode.index))
+	}
+	l := i.eval(*exprNode.exprBinaryNode.lhs)
+	r := i.eval(*exprNode.exprBinaryNode.rhs)
+	return i.binary(exprNode.exprType, l, r, exprNode.span)
+}
+
+// objectOf evaluates an expression that holds an object. Fields of a class
+// type that were never assigned hold no object.
+func (i *Interpreter) objectOf(exprNode ExprNode) *object {
+	o, _ := i.eval(exprNode).(*object)
+	if o == nil {
+		i.fail(exprNode.span, "use of an object that was never assigned")
+	}
+	return o
+}
+
+func (i *Interpreter) evalTerm(exprNode ExprNode) any {
+	termNode := exprNode.termNode
+	switch termNode.termType {
+	case TERM_INT:
+		// The parser reports literals that do not fit in an int, except for
+		// the 2147483648 of -2147483648, which wraps around to the smallest
+		// int and stays there once negated.
+		v, _ := strconv.ParseInt(termNode.value, 10, 64)
+		return int32(v)
+	case TERM_BOOL:
+		return termNode.value == "true"
+	case TERM_STRING:
+		return termNode.value
+	case TERM_IDENT:
+		return i.frame[termNode.symbol.slot]
+	case TERM_CALL:
+		return i.evalCall(termNode.callNode)
+	case TERM_INPUT:
+		line := i.readLine()
+		if termNode.value == "string" {
+			return line
+		}
+		return parseLeadingInt(line)
+	case TERM_ARRAY:
+		elements := []any{}
+		for _, element := range termNode.elements {
+			elements = append(elements, i.eval(element))
+		}
+		return &array{elements: elements}
+	case TERM_MAP:
+		m := newHashMap()
+		for n := range termNode.elements {
+			key := i.eval(termNode.elements[n])
+			v := i.eval(termNode.values[n])
+			m.values[m.find(key, true)] = v
+		}
+		return m
+	}
+	panic("Unknown Term")
+}
+
+// readLine reads a line from stdin without its newline. At the end of input
+// it returns the empty string.
+func (i *Interpreter) readLine() string {
+	i.out.Flush()
+	line, err := i.in.ReadString('\n')
+	if err != nil && line == "" {
+		return ""
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// parseLeadingInt reads the number at the start of a line the way strtol
+// does, truncated to 32 bits. Text that is not a number reads as 0.
+func parseLeadingInt(line string) int32 {
+	s := strings.TrimLeft(line, " \t\n\v\f\r")
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	digits := end
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == digits {
+		return 0
+	}
+	// Like strtol, out of range numbers are clamped to 64 bits.
+	v, _ := strconv.ParseInt(s[:end], 10, 64)
+	return int32(v)
+}
+
+func (i *Interpreter) evalCall(callNode CallNode) any {
+	switch callNode.symbol.kind {
+	case SYMBOL_BUILTIN:
+		return i.evalBuiltin(callNode)
+	case SYMBOL_CLASS:
+		return i.construct(callNode)
+	}
+	arguments, _ := callNode.symbol.methodNode.bindArguments(callNode.arguments)
+	return i.call(callNode.symbol.methodNode, arguments, nil)
+}
+
+// call runs a method in a fresh frame. The arguments, which include the
+// default values of omitted parameters, are computed in the frame of the
+// caller.
+func (i *Interpreter) call(methodNode *MethodNode, arguments []ExprNode, self *object) any {
+	frame := make([]any, methodNode.locals)
+	symbols := methodNode.paramSymbols()
+	if self != nil {
+		frame[symbols[0].slot] = self
+		symbols = symbols[1:]
+	}
+	for n, argument := range arguments {
+		frame[symbols[n].slot] = i.eval(argument)
+	}
+	caller, callerMethod := i.frame, i.method
+	i.frame, i.method = frame, methodNode
+	i.result = nil
+	i.runBlock(methodNode.blockNode)
+	i.frame, i.method = caller, callerMethod
+	return i.result
+}
+
+// construct creates an object, sets every field to its initial value, base
+// classes first, and runs init if the class has one.
+func (i *Interpreter) construct(callNode CallNode) any {
+	classNode := callNode.symbol.classNode
+	o := &object{classNode: classNode, fields: make([]any, len(classNode.layout))}
+	i.initFields(o, classNode)
+	if init, ok := classNode.members["init"]; ok && init.kind == SYMBOL_METHOD {
+		arguments, _ := init.methodNode.bindArguments(callNode.arguments)
+		i.call(init.methodNode, arguments, o)
+	}
+	return o
+}
+
+func (i *Interpreter) initFields(o *object, classNode *ClassNode) {
+	if classNode.base != nil {
+		i.initFields(o, classNode.base)
+	}
+	for _, fieldNode := range classNode.fields {
+		if fieldNode.initializer == nil {
+			o.fields[fieldNode.symbol.slot] = zeroValue(fieldNode.symbol.valueType)
+		} else {
+			o.fields[fieldNode.symbol.slot] = i.eval(*fieldNode.initializer)
+		}
+	}
+}
+
+func (i *Interpreter) evalBuiltin(callNode CallNode) any {
+	arguments := callNode.arguments
+	switch callNode.methodName {
+	case "len":
+		switch v := i.eval(arguments[0]).(type) {
+		case string:
+			return int32(len(v))
+		case *array:
+			return int32(len(v.elements))
+		case *hashMap:
+			return int32(v.count)
+		}
+	case "push":
+		a := i.eval(arguments[0]).(*array)
+		a.elements = append(a.elements, i.eval(arguments[1]))
+	case "delete":
+		m := i.eval(arguments[0]).(*hashMap)
+		m.remove(i.eval(arguments[1]))
+	case "contains":
+		m := i.eval(arguments[0]).(*hashMap)
+		return m.find(i.eval(arguments[1]), false) >= 0
+	}
+	return nil
+}
+
+// index reads `a[i]` once a and i are computed.
+func (i *Interpreter) index(exprNode ExprNode, container any, index any) any {
+	if a, ok := container.(*array); ok {
+		return a.elements[i.checkIndex(exprNode, a, index.(int32))]
+	}
+	m := container.(*hashMap)
+	slot := m.find(index, false)
+	if slot < 0 {
+		i.fail(exprNode.span, "key not found in map")
+	}
+	return m.values[slot]
+}
+
+func (i *Interpreter) setIndex(exprNode ExprNode, container any, index any, v any) {
+	if a, ok := container.(*array); ok {
+		a.elements[i.checkIndex(exprNode, a, index.(int32))] = v
+		return
+	}
+	m := container.(*hashMap)
+	m.values[m.find(index, true)] = v
+}
+
+func (i *Interpreter) checkIndex(exprNode ExprNode, a *array, index int32) int {
+	if index < 0 || int(index) >= len(a.elements) {
+		i.fail(exprNode.span, "index %d is out of bounds for length %d", index, len(a.elements))
+	}
+	return int(index)
+}
+
+// binary applies an arithmetic or comparison operator. Ints wrap around on
+// overflow, as 32 bit machine integers do.
+func (i *Interpreter) binary(exprType ExprType, l any, r any, span Span) any {
+	switch exprType {
+	case EXPR_EQUAL:
+		return l == r
+	case EXPR_NOT_EQUAL:
+		return l != r
+	}
+	if l, ok := l.(string); ok {
+		return l + r.(string)
+	}
+	a, b := l.(int32), r.(int32)
+	switch exprType {
+	case EXPR_PLUS:
+		return a + b
+	case EXPR_MINUS:
+		return a - b
+	case EXPR_MULTIPLY:
+		return a * b
+	case EXPR_DIVIDE, EXPR_MODULO:
+		if b == 0 {
+			i.fail(span, "division by zero")
+		}
+		if a == math.MinInt32 && b == -1 {
+			i.fail(span, "integer overflow")
+		}
+		if exprType == EXPR_DIVIDE {
+			return a / b
+		}
+		return a % b
+	case EXPR_LESS_THAN:
+		return a < b
+	case EXPR_GREATER_THAN:
+		return a > b
+	case EXPR_LESS_THAN_EQUAL:
+		return a <= b
+	case EXPR_GREATER_THAN_EQUAL:
+		return a >= b
+	}
+	panic("Unknown Expression")
+}
@@ -0,0 +1,137 @@
+package main
+
+// Values of the interpreter are int32, bool, string or a pointer to one of
+// the types below. Objects, arrays and maps are references, so Go's == on
+// values compares them the way the compiled programs do.
+
+// object is an instance of a class. fields follows the layout of the class.
+type object struct {
+	classNode *ClassNode
+	fields    []any
+}
+
+type array struct {
+	elements []any
+}
+
+// hashMap is a map with the same hash functions, probing and growth as the
+// runtime of the LLVM backend, so that iterating over it visits the keys in
+// the same order as compiled programs do.
+type hashMap struct {
+	count  int
+	filled int
+	states []byte
+	keys   []any
+	values []any
+}
+
+func newHashMap() *hashMap {
+	return &hashMap{
+		states: make([]byte, mapInitialCapacity),
+		keys:   make([]any, mapInitialCapacity),
+		values: make([]any, mapInitialCapacity),
+	}
+}
+
+// hashKey mirrors hashKey of the LLVM backend: ints and bools are mixed with
+// a multiplicative hash and strings are hashed with FNV-1a.
+func hashKey(key any) uint32 {
+	switch key := key.(type) {
+	case string:
+		h := uint32(2166136261)
+		for i := 0; i < len(key); i++ {
+			h = (h ^ uint32(key[i])) * 16777619
+		}
+		return h
+	case bool:
+		if key {
+			return hashKey(int32(1))
+		}
+		return hashKey(int32(0))
+	}
+	h := uint32(key.(int32)) * 2654435761
+	return h ^ h>>16
+}
+
+// find returns the slot of a key, or -1 if the map does not have it. With
+// insert set, a missing key is added to the first deleted slot of its probe,
+// or the empty slot that ended it.
+func (m *hashMap) find(key any, insert bool) int {
+	if insert && (m.filled+1)*4 > len(m.states)*3 {
+		m.grow()
+	}
+	mask := len(m.states) - 1
+	tomb := -1
+	i := int(hashKey(key)) & mask
+	for m.states[i] != slotEmpty {
+		if m.states[i] == slotFull && m.keys[i] == key {
+			return i
+		}
+		if m.states[i] == slotDeleted && tomb < 0 {
+			tomb = i
+		}
+		i = (i + 1) & mask
+	}
+	if !insert {
+		return -1
+	}
+	if tomb >= 0 {
+		i = tomb
+	} else {
+		m.filled++
+	}
+	m.states[i] = slotFull
+	m.keys[i] = key
+	m.count++
+	return i
+}
+
+// grow doubles the number of slots and inserts the keys again in the order
+// of their old slots.
+func (m *hashMap) grow() {
+	states, keys, values := m.states, m.keys, m.values
+	capacity := len(states) * 2
+	m.states = make([]byte, capacity)
+	m.keys = make([]any, capacity)
+	m.values = make([]any, capacity)
+	m.count, m.filled = 0, 0
+	for i, state := range states {
+		if state == slotFull {
+			m.values[m.find(keys[i], true)] = values[i]
+		}
+	}
+}
+
+func (m *hashMap) remove(key any) {
+	if i := m.find(key, false); i >= 0 {
+		m.states[i] = slotDeleted
+		m.keys[i] = nil
+		m.values[i] = nil
+		m.count--
+	}
+}
+
+// zeroValue is the value of variables and fields declared without one.
+// Objects start out as nil.
+func zeroValue(t *Type) any {
+	switch t.kind {
+	case TYPE_INT:
+		return int32(0)
+	case TYPE_BOOL:
+		return false
+	case TYPE_STRING:
+		return ""
+	case TYPE_MAP:
+		return newHashMap()
+	case TYPE_ARRAY:
+		if t.length == growable {
+			return &array{elements: []any{}}
+		}
+		elements := make([]any, t.length)
+		for i := range elements {
+			elements[i] = zeroValue(t.elem)
+		}
+		return &array{elements: elements}
+	}
+	return nil
+}
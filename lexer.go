@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 )
@@ -12,16 +13,30 @@ const (
 	LET                TokenType = "LET"
 	IF                 TokenType = "IF"
 	FOR                TokenType = "FOR"
+	WHILE              TokenType = "WHILE"
+	IN                 TokenType = "IN"
+	BREAK              TokenType = "BREAK"
+	CONTINUE           TokenType = "CONTINUE"
+	DOT_DOT            TokenType = "DOT_DOT"
+	DOT                TokenType = "DOT"
 	ELSE               TokenType = "ELSE"
 	PRINT              TokenType = "PRINT"
 	INPUT              TokenType = "INPUT"
 	INT                TokenType = "INT"
+	STRING             TokenType = "STRING"
+	TRUE               TokenType = "TRUE"
+	FALSE              TokenType = "FALSE"
 	EQUAL              TokenType = "EQUAL"
 	PLUS               TokenType = "PLUS"
 	MINUS              TokenType = "MINUS"
 	DIVIDE             TokenType = "DIVIDE"
 	MULTIPLY           TokenType = "MULTIPLY"
 	MODULO             TokenType = "MODULO"
+	PLUS_EQUAL         TokenType = "PLUS_EQUAL"
+	MINUS_EQUAL        TokenType = "MINUS_EQUAL"
+	MULTIPLY_EQUAL     TokenType = "MULTIPLY_EQUAL"
+	DIVIDE_EQUAL       TokenType = "DIVIDE_EQUAL"
+	MODULO_EQUAL       TokenType = "MODULO_EQUAL"
 	LESS_THAN          TokenType = "LESS_THAN"
 	GREATER_THAN       TokenType = "GREATER_THAN"
 	LESS_THAN_EQUAL    TokenType = "LESS_THAN_EQUAL"
@@ -39,107 +54,363 @@ const (
 	METHOD             TokenType = "METHOD"
 	TYPE               TokenType = "TYPE"
 	CLASS              TokenType = "CLASS"
+	INTERFACE          TokenType = "INTERFACE"
 	OPEN_PAREN         TokenType = "OPEN_PAREN"
 	CLOSE_PAREN        TokenType = "CLOSE_PAREN"
+	OPEN_BRACKET       TokenType = "OPEN_BRACKET"
+	CLOSE_BRACKET      TokenType = "CLOSE_BRACKET"
 	COLON              TokenType = "COLON"
+	COMMA              TokenType = "COMMA"
 	RETURN             TokenType = "RETURN"
 )
 
+var tokenSpellings = map[TokenType]string{
+	LET:                "let",
+	IF:                 "if",
+	FOR:                "for",
+	WHILE:              "while",
+	IN:                 "in",
+	BREAK:              "break",
+	CONTINUE:           "continue",
+	DOT_DOT:            "..",
+	DOT:                ".",
+	ELSE:               "else",
+	PRINT:              "print",
+	INPUT:              "input",
+	TRUE:               "true",
+	FALSE:              "false",
+	EQUAL:              "=",
+	PLUS:               "+",
+	MINUS:              "-",
+	DIVIDE:             "/",
+	MULTIPLY:           "*",
+	MODULO:             "%",
+	PLUS_EQUAL:         "+=",
+	MINUS_EQUAL:        "-=",
+	MULTIPLY_EQUAL:     "*=",
+	DIVIDE_EQUAL:       "/=",
+	MODULO_EQUAL:       "%=",
+	LESS_THAN:          "<",
+	GREATER_THAN:       ">",
+	LESS_THAN_EQUAL:    "<=",
+	GREATER_THAN_EQUAL: ">=",
+	EQUAL_EQUAL:        "==",
+	NOT_EQUAL:          "!=",
+	AND:                "&&",
+	OR:                 "||",
+	NOT:                "!",
+	BLOCK_START:        "{",
+	BLOCK_END:          "}",
+	METHOD:             "method",
+	CLASS:              "class",
+	INTERFACE:          "interface",
+	OPEN_PAREN:         "(",
+	CLOSE_PAREN:        ")",
+	OPEN_BRACKET:       "[",
+	CLOSE_BRACKET:      "]",
+	COLON:              ":",
+	COMMA:              ",",
+	RETURN:             "return",
+}
+
+type Position struct {
+	offset int
+	line   int
+	column int
+}
+
+type Span struct {
+	start Position
+	end   Position
+}
+
 type Token struct {
 	tokenType TokenType
 	value     string
+	span      Span
 }
 
 type Lexer struct {
 	buffer string
 	pos    int
+	line   int
+	column int
+	diags  *Diagnostics
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.column)
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.start, s.end)
+}
+
+// spanBetween covers everything from the start of a to the end of b.
+func spanBetween(a Span, b Span) Span {
+	return Span{a.start, b.end}
+}
+
+// describe renders a token for use in diagnostics.
+func (t Token) describe() string {
+	switch t.tokenType {
+	case IDENTIFIER, INT:
+		return fmt.Sprintf("`%s`", t.value)
+	case STRING:
+		return "string literal"
+	case END:
+		return "end of file"
+	}
+	if spelling, ok := tokenSpellings[t.tokenType]; ok {
+		return fmt.Sprintf("`%s`", spelling)
+	}
+	return string(t.tokenType)
 }
 
 func (l Lexer) currChar() byte {
 	return l.buffer[l.pos]
 }
 
+func (l Lexer) peekChar() byte {
+	if l.pos+1 < len(l.buffer) {
+		return l.buffer[l.pos+1]
+	}
+	return 0
+}
+
+// isLetter reports whether c can start an identifier. Identifiers are ASCII,
+// so a byte of a multibyte character is never a letter on its own.
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func (l Lexer) position() Position {
+	return Position{l.pos, l.line, l.column}
+}
+
+func (l *Lexer) advance() {
+	if l.currChar() == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	l.pos++
+}
+
 func (l Lexer) isBufferNotEmpty() bool {
 	return l.pos < len(l.buffer)
 }
 
 func (l *Lexer) nextToken() Token {
+	start := l.position()
+	tokenType, value := l.scanToken()
+	return Token{tokenType, value, Span{start, l.position()}}
+}
+
+// escapeSequences maps the character after a backslash in a string literal
+// to the byte it stands for.
+var escapeSequences = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+}
+
+// scanString reads a string literal and decodes its escape sequences. A
+// literal missing its closing quote ends at the end of the line.
+func (l *Lexer) scanString() (TokenType, string) {
+	var value strings.Builder
+	start := l.position()
+	l.advance()
+	for l.isBufferNotEmpty() && l.currChar() != '"' && l.currChar() != '\n' {
+		if l.currChar() != '\\' {
+			value.WriteByte(l.currChar())
+			l.advance()
+			continue
+		}
+		escapeStart := l.position()
+		l.advance()
+		if !l.isBufferNotEmpty() || l.currChar() == '\n' {
+			break
+		}
+		escape := l.currChar()
+		l.advance()
+		if decoded, ok := escapeSequences[escape]; ok {
+			value.WriteByte(decoded)
+		} else {
+			l.diags.error(Span{escapeStart, l.position()}, ERR_INVALID_ESCAPE, "unknown escape sequence `\\%c`", escape)
+		}
+	}
+	if l.isBufferNotEmpty() && l.currChar() == '"' {
+		l.advance()
+	} else {
+		l.diags.error(Span{start, l.position()}, ERR_UNTERMINATED_STRING, "unterminated string literal")
+	}
+	return STRING, value.String()
+}
+
+func (l *Lexer) scanToken() (TokenType, string) {
 	var value strings.Builder
 	if unicode.IsSpace(rune(l.currChar())) {
-		l.pos++
-		return Token{SPACE, ""}
+		l.advance()
+		return SPACE, ""
+	} else if l.currChar() == '"' {
+		return l.scanString()
 	} else if l.currChar() == '{' {
-		l.pos++
-		return Token{BLOCK_START, ""}
+		l.advance()
+		return BLOCK_START, ""
 	} else if l.currChar() == '}' {
-		l.pos++
-		return Token{BLOCK_END, ""}
+		l.advance()
+		return BLOCK_END, ""
 	} else if l.currChar() == '(' {
-		l.pos++
-		return Token{OPEN_PAREN, ""}
+		l.advance()
+		return OPEN_PAREN, ""
 	} else if l.currChar() == ')' {
-		l.pos++
-		return Token{CLOSE_PAREN, ""}
+		l.advance()
+		return CLOSE_PAREN, ""
+	} else if l.currChar() == '[' {
+		l.advance()
+		return OPEN_BRACKET, ""
+	} else if l.currChar() == ']' {
+		l.advance()
+		return CLOSE_BRACKET, ""
 	} else if l.currChar() == ':' {
-		l.pos++
-		return Token{COLON, ""}
+		l.advance()
+		return COLON, ""
+	} else if l.currChar() == '.' && l.peekChar() == '.' {
+		l.advance()
+		l.advance()
+		return DOT_DOT, ""
+	} else if l.currChar() == '.' {
+		l.advance()
+		return DOT, ""
+	} else if l.currChar() == ',' {
+		l.advance()
+		return COMMA, ""
+	} else if l.currChar() == '=' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return EQUAL_EQUAL, ""
 	} else if l.currChar() == '=' {
-		l.pos++
-		return Token{EQUAL, ""}
+		l.advance()
+		return EQUAL, ""
+	} else if l.currChar() == '!' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return NOT_EQUAL, ""
+	} else if l.currChar() == '!' {
+		l.advance()
+		return NOT, ""
+	} else if l.currChar() == '&' && l.peekChar() == '&' {
+		l.advance()
+		l.advance()
+		return AND, ""
+	} else if l.currChar() == '|' && l.peekChar() == '|' {
+		l.advance()
+		l.advance()
+		return OR, ""
+	} else if l.currChar() == '+' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return PLUS_EQUAL, ""
 	} else if l.currChar() == '+' {
-		l.pos++
-		return Token{PLUS, ""}
+		l.advance()
+		return PLUS, ""
+	} else if l.currChar() == '%' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return MODULO_EQUAL, ""
 	} else if l.currChar() == '%' {
-		l.pos++
-		return Token{MODULO, ""}
+		l.advance()
+		return MODULO, ""
+	} else if l.currChar() == '-' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return MINUS_EQUAL, ""
 	} else if l.currChar() == '-' {
-		l.pos++
-		return Token{MINUS, ""}
+		l.advance()
+		return MINUS, ""
+	} else if l.currChar() == '*' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return MULTIPLY_EQUAL, ""
 	} else if l.currChar() == '*' {
-		l.pos++
-		return Token{MULTIPLY, ""}
+		l.advance()
+		return MULTIPLY, ""
+	} else if l.currChar() == '/' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return DIVIDE_EQUAL, ""
 	} else if l.currChar() == '/' {
-		l.pos++
-		return Token{DIVIDE, ""}
+		l.advance()
+		return DIVIDE, ""
+	} else if l.currChar() == '<' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return LESS_THAN_EQUAL, ""
 	} else if l.currChar() == '<' {
-		l.pos++
-		return Token{LESS_THAN, ""}
+		l.advance()
+		return LESS_THAN, ""
+	} else if l.currChar() == '>' && l.peekChar() == '=' {
+		l.advance()
+		l.advance()
+		return GREATER_THAN_EQUAL, ""
+	} else if l.currChar() == '>' {
+		l.advance()
+		return GREATER_THAN, ""
 	} else if unicode.IsDigit(rune(l.currChar())) {
 		for l.isBufferNotEmpty() && unicode.IsDigit(rune(l.currChar())) {
 			value.WriteString(string(l.currChar()))
-			l.pos++
+			l.advance()
 		}
-		return Token{INT, value.String()}
-	} else if unicode.IsLetter(rune(l.currChar())) || l.currChar() == '_' {
-		for l.isBufferNotEmpty() && (unicode.IsLetter(rune(l.currChar())) || l.currChar() == '_') {
+		return INT, value.String()
+	} else if isLetter(l.currChar()) {
+		for l.isBufferNotEmpty() && (isLetter(l.currChar()) || unicode.IsDigit(rune(l.currChar()))) {
 			value.WriteString(string(l.currChar()))
-			l.pos++
+			l.advance()
 		}
 		if value.String() == "input" {
-			return Token{INPUT, ""}
+			return INPUT, ""
 		} else if value.String() == "print" {
-			return Token{PRINT, ""}
+			return PRINT, ""
 		} else if value.String() == "if" {
-			return Token{IF, ""}
+			return IF, ""
 		} else if value.String() == "for" {
-			return Token{FOR, ""}
+			return FOR, ""
+		} else if value.String() == "while" {
+			return WHILE, ""
+		} else if value.String() == "in" {
+			return IN, ""
+		} else if value.String() == "break" {
+			return BREAK, ""
+		} else if value.String() == "continue" {
+			return CONTINUE, ""
 		} else if value.String() == "else" {
-			return Token{ELSE, ""}
+			return ELSE, ""
 		} else if value.String() == "let" {
-			return Token{LET, ""}
+			return LET, ""
 		} else if value.String() == "method" {
-			return Token{METHOD, ""}
+			return METHOD, ""
 		} else if value.String() == "class" {
-			return Token{CLASS, ""}
+			return CLASS, ""
+		} else if value.String() == "interface" {
+			return INTERFACE, ""
 		} else if value.String() == "return" {
-			return Token{RETURN, ""}
+			return RETURN, ""
+		} else if value.String() == "true" {
+			return TRUE, ""
+		} else if value.String() == "false" {
+			return FALSE, ""
 		} else {
-			return Token{IDENTIFIER, value.String()}
+			return IDENTIFIER, value.String()
 		}
 	} else {
 		value.WriteString(string(l.currChar()))
-		l.pos++
-		return Token{INVALID, value.String()}
+		l.advance()
+		return INVALID, value.String()
 	}
 }
 
@@ -149,8 +420,9 @@ func (l Lexer) tokenize() []Token {
 
 	for l.isBufferNotEmpty() {
 		token = l.nextToken()
-		if token.tokenType != SPACE {
-			// fmt.Println(token.tokenType)
+		if token.tokenType == INVALID {
+			l.diags.error(token.span, ERR_INVALID_CHARACTER, "unexpected character `%s`", token.value)
+		} else if token.tokenType != SPACE {
 			tokens = append(tokens, token)
 		}
 
@@ -159,6 +431,6 @@ func (l Lexer) tokenize() []Token {
 	return tokens
 }
 
-func newLexer(buffer string) Lexer {
-	return Lexer{buffer, 0}
+func newLexer(buffer string, diags *Diagnostics) Lexer {
+	return Lexer{buffer, 0, 1, 1, diags}
 }
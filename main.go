@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage: yeol <command> [flags] file.yeol
+
+commands:
+  build   compile a program
+  run     run a program
+  check   report the errors and warnings of a program
+  fmt     print a program in the standard layout
+  tokens  print the tokens of a program
+  ast     print the syntax tree of a program
+  ir      print the LLVM IR or NASM assembly of a program
+  repl    read and run statements interactively
+
+flags:
+  --backend=llvm|nasm|interp  backend to compile or run with
+  -o path                     output file, - for stdout
+  --emit=tokens|ast|ll|asm|obj|exe
+                              what build writes
+  --format=tree|sexpr|json    how ast writes the syntax tree
+`
+
+// Exit statuses of yeol itself. yeol run exits with the status of the
+// program instead.
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type Backend string
+
+const (
+	BACKEND_LLVM   Backend = "llvm"
+	BACKEND_NASM   Backend = "nasm"
+	BACKEND_INTERP Backend = "interp"
+)
+
+type Emit string
+
+const (
+	EMIT_TOKENS Emit = "tokens"
+	EMIT_AST    Emit = "ast"
+	EMIT_LL     Emit = "ll"
+	EMIT_ASM    Emit = "asm"
+	EMIT_OBJ    Emit = "obj"
+	EMIT_EXE    Emit = "exe"
+)
+
+// Options are the command line of yeol. output is empty when the command
+// decides where its output goes.
+type Options struct {
+	command  string
+	backend  Backend
+	emit     Emit
+	format   AstFormat
+	output   string
+	fileName string
+}
+
+// usageError is a command line yeol does not understand.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+// errFailed reports that a command failed after its diagnostics were
+// written.
+var errFailed = errors.New("failed")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(os.Args) < 2 {
+			os.Exit(exitUsage)
+		}
+		os.Exit(exitSuccess)
+	}
+	options, err := parseOptions(os.Args[1], os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "yeol: %s\nrun `yeol help` for usage\n", err)
+		os.Exit(exitUsage)
+	}
+	os.Exit(runCommand(options))
+}
+
+// parseOptions reads the flags and the file of a command. Flags may come
+// before or after the file.
+func parseOptions(command string, args []string) (Options, error) {
+	options := Options{command: command}
+	var backend, emit, format string
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&backend, "backend", "", "")
+	flags.StringVar(&emit, "emit", "", "")
+	flags.StringVar(&format, "format", "", "")
+	flags.StringVar(&options.output, "o", "", "")
+	files := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return options, usageError{err.Error()}
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		files = append(files, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	options.backend = Backend(backend)
+	options.emit = Emit(emit)
+	options.format = AstFormat(format)
+
+	switch command {
+	case "repl":
+		if len(files) > 0 || backend != "" || emit != "" || format != "" || options.output != "" {
+			return options, usageError{"repl takes no file or flags"}
+		}
+		return options, nil
+	case "build", "run", "check", "fmt", "tokens", "ast", "ir":
+	default:
+		return options, usageError{fmt.Sprintf("unknown command `%s`", command)}
+	}
+	if len(files) != 1 {
+		return options, usageError{fmt.Sprintf("%s takes one file but got %d", command, len(files))}
+	}
+	options.fileName = files[0]
+
+	switch options.backend {
+	case "", BACKEND_LLVM, BACKEND_NASM, BACKEND_INTERP:
+	default:
+		return options, usageError{fmt.Sprintf("unknown backend `%s`", backend)}
+	}
+	switch options.emit {
+	case "", EMIT_TOKENS, EMIT_AST, EMIT_LL, EMIT_ASM, EMIT_OBJ, EMIT_EXE:
+	default:
+		return options, usageError{fmt.Sprintf("unknown output `--emit=%s`", emit)}
+	}
+	switch options.format {
+	case "", AST_TREE, AST_SEXPR, AST_JSON:
+	default:
+		return options, usageError{fmt.Sprintf("unknown format `%s`", format)}
+	}
+	if options.emit != "" && command != "build" {
+		return options, usageError{fmt.Sprintf("--emit only applies to build, not %s", command)}
+	}
+	if options.format != "" && command != "ast" && options.emit != EMIT_AST {
+		return options, usageError{fmt.Sprintf("--format only applies to ast, not %s", command)}
+	}
+	if options.output != "" && (command == "run" || command == "check") {
+		return options, usageError{fmt.Sprintf("-o does not apply to %s", command)}
+	}
+	if options.backend != "" && command != "build" && command != "run" && command != "check" && command != "ir" {
+		return options, usageError{fmt.Sprintf("--backend does not apply to %s", command)}
+	}
+
+	switch command {
+	case "run":
+		if options.backend == "" {
+			options.backend = BACKEND_INTERP
+		}
+	case "build", "ir":
+		if command == "ir" {
+			options.emit = EMIT_LL
+			if options.backend == BACKEND_NASM {
+				options.emit = EMIT_ASM
+			}
+		}
+		if options.backend == BACKEND_INTERP {
+			return options, usageError{fmt.Sprintf("%s needs a compiling backend, llvm or nasm", command)}
+		}
+		// The output picks the backend when only it is given.
+		if options.backend == "" {
+			options.backend = BACKEND_LLVM
+			if options.emit == EMIT_ASM {
+				options.backend = BACKEND_NASM
+			}
+		}
+		if options.emit == "" {
+			options.emit = EMIT_EXE
+		}
+		if (options.emit == EMIT_LL && options.backend != BACKEND_LLVM) || (options.emit == EMIT_ASM && options.backend != BACKEND_NASM) {
+			return options, usageError{fmt.Sprintf("the %s backend cannot emit %s", options.backend, options.emit)}
+		}
+		if (options.emit == EMIT_OBJ || options.emit == EMIT_EXE) && options.output == "-" {
+			return options, usageError{fmt.Sprintf("cannot write %s to stdout", options.emit)}
+		}
+	case "check":
+		if options.backend == BACKEND_INTERP {
+			options.backend = ""
+		}
+	}
+	return options, nil
+}
+
+// runCommand runs a command and returns the exit status of yeol.
+func runCommand(options Options) int {
+	if options.command == "repl" {
+		return newRepl(os.Stdin, os.Stdout).run()
+	}
+	buffer, err := os.ReadFile(options.fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "yeol: %s\n", err)
+		return exitFailure
+	}
+	diags := newDiagnostics(options.fileName, string(buffer))
+
+	switch options.command {
+	case "run":
+		programNode, ok := analyze(diags)
+		if !ok {
+			return exitFailure
+		}
+		if options.backend == BACKEND_INTERP {
+			return newInterpreter(programNode, os.Stdin, os.Stdout).run()
+		}
+		text, err := generate(programNode, diags, options.backend)
+		if err != nil {
+			return exitFailure
+		}
+		status, err := runNative(text, options.backend, options.fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "yeol: %s\n", err)
+		}
+		return status
+	case "check":
+		programNode, ok := analyze(diags)
+		if ok && options.backend != "" {
+			_, err = generate(programNode, diags, options.backend)
+		}
+		if !ok || err != nil {
+			return exitFailure
+		}
+		return exitSuccess
+	case "fmt":
+		err = emit(diags, options, EMIT_AST, func(tokens []Token, programNode ProgramNode) (string, error) {
+			return formatProgram(programNode), nil
+		})
+	case "tokens":
+		err = emit(diags, options, EMIT_TOKENS, formatTokens)
+	case "ast":
+		err = emit(diags, options, EMIT_AST, options.formatAst)
+	case "build", "ir":
+		switch options.emit {
+		case EMIT_TOKENS:
+			err = emit(diags, options, EMIT_TOKENS, formatTokens)
+		case EMIT_AST:
+			err = emit(diags, options, EMIT_AST, options.formatAst)
+		case EMIT_OBJ, EMIT_EXE:
+			programNode, ok := analyze(diags)
+			if !ok {
+				return exitFailure
+			}
+			text, err := generate(programNode, diags, options.backend)
+			if err != nil {
+				return exitFailure
+			}
+			err = buildNative(text, options.backend, options.emit, options.fileName, outputPath(options))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "yeol: %s\n", err)
+				return exitFailure
+			}
+		default:
+			err = emit(diags, options, options.emit, func(tokens []Token, programNode ProgramNode) (string, error) {
+				return generate(programNode, diags, options.backend)
+			})
+		}
+	}
+	if err != nil {
+		if err != errFailed {
+			fmt.Fprintf(os.Stderr, "yeol: %s\n", err)
+		}
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// emit runs the front end as far as output needs and writes what write
+// makes of it. Tokens need only the lexer and syntax trees only the parser;
+// compiled output needs a checked program.
+func emit(diags *Diagnostics, options Options, output Emit, write func([]Token, ProgramNode) (string, error)) error {
+	tokens := newLexer(diags.source, diags).tokenize()
+	if reportDiagnostics(diags) {
+		return errFailed
+	}
+	var programNode ProgramNode
+	if output != EMIT_TOKENS {
+		p := newParser(tokens, diags)
+		programNode = p.parseProgram()
+		if reportDiagnostics(diags) {
+			return errFailed
+		}
+	}
+	if output != EMIT_TOKENS && output != EMIT_AST {
+		if !check(&programNode, diags) {
+			return errFailed
+		}
+	}
+	text, err := write(tokens, programNode)
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputPath(options), text)
+}
+
+// outputPath is where a command writes its output. Text meant to be read
+// goes to stdout, compiled output next to the source file.
+func outputPath(options Options) string {
+	if options.output != "" {
+		return options.output
+	}
+	extension, compiled := map[Emit]string{EMIT_LL: ".ll", EMIT_ASM: ".asm", EMIT_OBJ: ".o", EMIT_EXE: ""}[options.emit]
+	if options.command != "build" || !compiled {
+		return "-"
+	}
+	return strings.TrimSuffix(options.fileName, filepath.Ext(options.fileName)) + extension
+}
+
+func writeOutput(path string, text string) error {
+	if path == "-" {
+		_, err := io.WriteString(os.Stdout, text)
+		return err
+	}
+	return os.WriteFile(path, []byte(text), 0644)
+}
+
+// analyze runs the lexer, parser, resolver and type checker over a source
+// file. It stops after the first of them that reports an error.
+func analyze(diags *Diagnostics) (ProgramNode, bool) {
+	l := newLexer(diags.source, diags)
+	tokens := l.tokenize()
+	if reportDiagnostics(diags) {
+		return ProgramNode{}, false
+	}
+	p := newParser(tokens, diags)
+	programNode := p.parseProgram()
+	if reportDiagnostics(diags) {
+		return ProgramNode{}, false
+	}
+	return programNode, check(&programNode, diags)
+}
+
+// check resolves and type checks a parsed program.
+func check(programNode *ProgramNode, diags *Diagnostics) bool {
+	r := newResolver(diags)
+	r.resolveProgram(programNode)
+	if reportDiagnostics(diags) {
+		return false
+	}
+	c := newChecker(diags)
+	c.checkProgram(programNode)
+	return !reportDiagnostics(diags)
+}
+
+// generate compiles a checked program to LLVM IR or NASM assembly.
+func generate(programNode ProgramNode, diags *Diagnostics, backend Backend) (string, error) {
+	var text string
+	switch backend {
+	case BACKEND_LLVM:
+		c := newCompiler(programNode, diags)
+		c.compileProgram()
+		text = c.module.String()
+	case BACKEND_NASM:
+		a := newAssembler(programNode, diags)
+		a.assembleProgram()
+		text = a.fileSb.String()
+	}
+	if reportDiagnostics(diags) {
+		return "", errFailed
+	}
+	return text, nil
+}
+
+// reportDiagnostics writes the diagnostics collected so far to stderr and
+// tells whether any of them is an error.
+func reportDiagnostics(diags *Diagnostics) bool {
+	fmt.Fprint(os.Stderr, diags)
+	hasErrors := diags.hasErrors()
+	diags.diagnostics = []Diagnostic{}
+	return hasErrors
+}
+
+func formatTokens(tokens []Token, programNode ProgramNode) (string, error) {
+	var sb strings.Builder
+	for _, token := range tokens {
+		switch token.tokenType {
+		case STRING:
+			fmt.Fprintf(&sb, "%s %s %s\n", token.span.start, token.tokenType, quoteString(token.value))
+		case IDENTIFIER, INT:
+			fmt.Fprintf(&sb, "%s %s %s\n", token.span.start, token.tokenType, token.value)
+		default:
+			fmt.Fprintf(&sb, "%s %s\n", token.span.start, token.tokenType)
+		}
+	}
+	return sb.String(), nil
+}
+
+func (options Options) formatAst(tokens []Token, programNode ProgramNode) (string, error) {
+	return formatProgramAst(programNode, options.format)
+}
@@ -1,165 +1,598 @@
 package main
 
-import "slices"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 type InstType string
 
 const (
-	INST_ASSIGN InstType = "INST_ASSIGN"
-	INST_IF     InstType = "INST_IF"
-	INST_PRINT  InstType = "INST_PRINT"
-	INST_ELSE   InstType = "INST_ELSE"
-	INST_METHOD InstType = "INST_METHOD"
-	INST_CLASS  InstType = "INST_CLASS"
-	INST_RETURN InstType = "INST_RETURN"
+	INST_ASSIGN    InstType = "INST_ASSIGN"
+	INST_REASSIGN  InstType = "INST_REASSIGN"
+	INST_IF        InstType = "INST_IF"
+	INST_PRINT     InstType = "INST_PRINT"
+	INST_ELSE      InstType = "INST_ELSE"
+	INST_METHOD    InstType = "INST_METHOD"
+	INST_CLASS     InstType = "INST_CLASS"
+	INST_INTERFACE InstType = "INST_INTERFACE"
+	INST_RETURN    InstType = "INST_RETURN"
+	INST_WHILE     InstType = "INST_WHILE"
+	INST_FOR       InstType = "INST_FOR"
+	INST_BREAK     InstType = "INST_BREAK"
+	INST_CONTINUE  InstType = "INST_CONTINUE"
+	INST_CALL      InstType = "INST_CALL"
 )
 
 type ExprType string
 
 const (
-	EXPR_TERM ExprType = "EXPR_TERM"
-	EXPR_PLUS ExprType = "EXPR_PLUS"
-)
-
-type RelType string
-
-const (
-	REL_LESS_THAN RelType = "REL_LESS_THAN"
+	EXPR_TERM               ExprType = "EXPR_TERM"
+	EXPR_PLUS               ExprType = "EXPR_PLUS"
+	EXPR_MINUS              ExprType = "EXPR_MINUS"
+	EXPR_MULTIPLY           ExprType = "EXPR_MULTIPLY"
+	EXPR_DIVIDE             ExprType = "EXPR_DIVIDE"
+	EXPR_MODULO             ExprType = "EXPR_MODULO"
+	EXPR_NEGATE             ExprType = "EXPR_NEGATE"
+	EXPR_LESS_THAN          ExprType = "EXPR_LESS_THAN"
+	EXPR_GREATER_THAN       ExprType = "EXPR_GREATER_THAN"
+	EXPR_LESS_THAN_EQUAL    ExprType = "EXPR_LESS_THAN_EQUAL"
+	EXPR_GREATER_THAN_EQUAL ExprType = "EXPR_GREATER_THAN_EQUAL"
+	EXPR_EQUAL              ExprType = "EXPR_EQUAL"
+	EXPR_NOT_EQUAL          ExprType = "EXPR_NOT_EQUAL"
+	EXPR_AND                ExprType = "EXPR_AND"
+	EXPR_OR                 ExprType = "EXPR_OR"
+	EXPR_NOT                ExprType = "EXPR_NOT"
+	EXPR_MEMBER             ExprType = "EXPR_MEMBER"
+	EXPR_MEMBER_CALL        ExprType = "EXPR_MEMBER_CALL"
+	EXPR_INDEX              ExprType = "EXPR_INDEX"
 )
 
 type TermType string
 
 const (
-	TERM_INPUT TermType = "TERM_INPUT"
-	TERM_INT   TermType = "TERM_INT"
-	TERM_IDENT TermType = "TERM_IDENT"
+	TERM_INPUT  TermType = "TERM_INPUT"
+	TERM_INT    TermType = "TERM_INT"
+	TERM_BOOL   TermType = "TERM_BOOL"
+	TERM_STRING TermType = "TERM_STRING"
+	TERM_IDENT  TermType = "TERM_IDENT"
+	TERM_CALL   TermType = "TERM_CALL"
+	TERM_ARRAY  TermType = "TERM_ARRAY"
+	TERM_MAP    TermType = "TERM_MAP"
 )
 
 type ExprNode struct {
 	exprType       ExprType
-	termBinaryNode TermBinaryNode
+	exprBinaryNode ExprBinaryNode
+	exprUnaryNode  ExprUnaryNode
 	termNode       TermNode
+	memberNode     MemberNode
+	indexNode      IndexNode
+	valueType      *Type
+	span           Span
+}
+
+type ExprBinaryNode struct {
+	lhs  *ExprNode
+	rhs  *ExprNode
+	span Span
+}
+
+type ExprUnaryNode struct {
+	operand *ExprNode
+	span    Span
 }
 
-type TermBinaryNode struct {
-	rhs TermNode
-	lhs TermNode
+// MemberNode is a field access `object.name`, or a method call
+// `object.name(...)` whose arguments are in callNode. The checker sets
+// symbol to the field or method once it knows the class of object.
+type MemberNode struct {
+	object   *ExprNode
+	name     string
+	callNode CallNode
+	symbol   *Symbol
+	span     Span
 }
 
-type RelNode struct {
-	relType        RelType
-	termBinaryNode TermBinaryNode
+// IndexNode is an element access `array[index]`.
+type IndexNode struct {
+	array *ExprNode
+	index *ExprNode
+	span  Span
 }
 
+// TermNode is an operand. For TERM_INPUT value is the name of the type to
+// read, and for TERM_ARRAY elements holds the values of the literal. For
+// TERM_MAP elements holds the keys and values the value of each key.
 type TermNode struct {
 	termType TermType
 	value    string
+	callNode CallNode
+	elements []ExprNode
+	values   []ExprNode
+	symbol   *Symbol
+	span     Span
+}
+
+type CallNode struct {
+	methodName string
+	arguments  []ExprNode
+	symbol     *Symbol
+	span       Span
 }
 
+// AssignNode declares a variable. typeName is empty when the type is
+// inferred from expr, and expr is empty when the variable starts out as the
+// zero value of its type.
 type AssignNode struct {
 	identifier string
 	typeName   string
 	expr       ExprNode
+	symbol     *Symbol
+	span       Span
+}
+
+// ReassignNode stores into an existing variable or field. For compound
+// assignments such as `x += 1` operator holds the arithmetic applied to the
+// old value.
+type ReassignNode struct {
+	target   ExprNode
+	operator ExprType
+	expr     ExprNode
+	span     Span
 }
 
 type IfNode struct {
-	relNode       RelNode
+	condNode      ExprNode
 	ifBlockNode   BlockNode
 	elseBlockNode BlockNode
+	span          Span
+}
+
+type WhileNode struct {
+	condNode  ExprNode
+	blockNode BlockNode
+	span      Span
+}
+
+// ForNode loops over the range from startNode to endNode or, when arrayNode
+// is set, over the elements of an array.
+type ForNode struct {
+	identifier string
+	startNode  ExprNode
+	endNode    ExprNode
+	arrayNode  ExprNode
+	blockNode  BlockNode
+	symbol     *Symbol
+	span       Span
 }
 
 type PrintNode struct {
-	termNode TermNode
+	exprNode ExprNode
+	span     Span
 }
 
 type BlockNode struct {
 	instructions []InstNode
+	span         Span
 }
 
+// ClassNode is a class. supertypes names the base class, if any, and the
+// interfaces the class implements, as written after the colon.
 type ClassNode struct {
 	className     string
+	supertypes    []string
 	functionNames []string
 	varNames      []string
-	blockNode     BlockNode
+	fields        []FieldNode
+	methods       []MethodNode
+	base          *ClassNode
+	interfaces    []*InterfaceNode
+	// members maps the names of the fields and methods, inherited ones
+	// included, to their symbols.
+	members map[string]*Symbol
+	// layout lists every field in object order, starting with the inherited
+	// ones, and vtable every method in dispatch order.
+	layout []*Symbol
+	vtable []*Symbol
+	symbol *Symbol
+	span   Span
+}
+
+// InterfaceNode declares the methods a class must have to implement it. Its
+// methods have no body.
+type InterfaceNode struct {
+	name    string
+	methods []MethodNode
+	// members maps the method names to their symbols, whose slot is the
+	// position of the method in the method table of an interface value.
+	members map[string]*Symbol
+	symbol  *Symbol
+	span    Span
+}
+
+// FieldNode declares a field of a class. Fields without an initializer
+// start out as the zero value of their type.
+type FieldNode struct {
+	name        string
+	typeName    string
+	initializer *ExprNode
+	symbol      *Symbol
+	span        Span
 }
 
+// MethodNode is a method, either at the top level or inside the class or
+// interface named className. Methods of a class receive the object as the
+// implicit parameter self.
 type MethodNode struct {
 	methodName string
-	parameters map[string]string
+	className  string
+	// overrides is the method of a base class that this method replaces.
+	overrides  *Symbol
+	parameters []ParamNode
 	returnType string
 	varNames   []string
 	blockNode  BlockNode
+	// locals is the number of variable slots, parameters included, that the
+	// method needs in its frame.
+	locals int
+	self   *Symbol
+	symbol *Symbol
+	span   Span
+}
+
+// ParamNode is a single method parameter. defaultValue is nil unless the
+// parameter may be omitted by callers.
+type ParamNode struct {
+	name         string
+	typeName     string
+	defaultValue *ExprNode
+	symbol       *Symbol
+	span         Span
 }
 
+// ReturnNode leaves the current method. exprNode is empty (no exprType) for a
+// bare `return` from a void method.
 type ReturnNode struct {
 	exprNode ExprNode
+	span     Span
 }
 
 type InstNode struct {
-	instType   InstType
-	assignNode AssignNode
-	ifNode     IfNode
-	printNode  PrintNode
-	methodNode MethodNode
-	classNode  ClassNode
-	returnNode ReturnNode
+	instType      InstType
+	assignNode    AssignNode
+	reassignNode  ReassignNode
+	ifNode        IfNode
+	printNode     PrintNode
+	methodNode    MethodNode
+	classNode     ClassNode
+	interfaceNode InterfaceNode
+	returnNode    ReturnNode
+	exprNode      ExprNode
+	whileNode     WhileNode
+	forNode       ForNode
+	span          Span
 }
 
 type ProgramNode struct {
 	instructions []InstNode
 	fileName     string
+	locals       int
+	span         Span
+}
+
+type binaryOperator struct {
+	precedence int
+	exprType   ExprType
+}
+
+// binaryOperators maps each infix operator to its binding power; all of
+// them are left-associative.
+var binaryOperators = map[TokenType]binaryOperator{
+	OR:                 {1, EXPR_OR},
+	AND:                {2, EXPR_AND},
+	LESS_THAN:          {3, EXPR_LESS_THAN},
+	GREATER_THAN:       {3, EXPR_GREATER_THAN},
+	LESS_THAN_EQUAL:    {3, EXPR_LESS_THAN_EQUAL},
+	GREATER_THAN_EQUAL: {3, EXPR_GREATER_THAN_EQUAL},
+	EQUAL_EQUAL:        {3, EXPR_EQUAL},
+	NOT_EQUAL:          {3, EXPR_NOT_EQUAL},
+	PLUS:               {4, EXPR_PLUS},
+	MINUS:              {4, EXPR_MINUS},
+	MULTIPLY:           {5, EXPR_MULTIPLY},
+	DIVIDE:             {5, EXPR_DIVIDE},
+	MODULO:             {5, EXPR_MODULO},
+}
+
+var compoundOperators = map[TokenType]ExprType{
+	PLUS_EQUAL:     EXPR_PLUS,
+	MINUS_EQUAL:    EXPR_MINUS,
+	MULTIPLY_EQUAL: EXPR_MULTIPLY,
+	DIVIDE_EQUAL:   EXPR_DIVIDE,
+	MODULO_EQUAL:   EXPR_MODULO,
 }
 
 type Parser struct {
-	tokens []Token
-	index  int
+	tokens    []Token
+	index     int
+	diags     *Diagnostics
+	loopDepth int
+	// negated is set when the int literal about to be parsed is the operand
+	// of a unary minus, which is the only place 2147483648 may appear.
+	negated bool
 }
 
+// parseError unwinds the parser once a syntax error has been reported.
+type parseError struct{}
+
 func (b BlockNode) getFunctionNames() []string {
 	functionNames := []string{}
+	for _, instNode := range b.instructions {
+		if instNode.instType == INST_METHOD {
+			functionNames = append(functionNames, instNode.methodNode.methodName)
+		}
+	}
 	return functionNames
 }
 
+// qualifiedName is the name of a method prefixed with its class, if any.
+func (m MethodNode) qualifiedName() string {
+	if m.className == "" {
+		return m.methodName
+	}
+	return m.className + "." + m.methodName
+}
+
+// paramSymbols lists the symbols of the parameters in the order the function
+// receives them, starting with self for methods of a class.
+func (m MethodNode) paramSymbols() []*Symbol {
+	symbols := []*Symbol{}
+	if m.self != nil {
+		symbols = append(symbols, m.self)
+	}
+	for _, paramNode := range m.parameters {
+		symbols = append(symbols, paramNode.symbol)
+	}
+	return symbols
+}
+
+// isAssignable reports whether the expression names a storage location.
+func (e ExprNode) isAssignable() bool {
+	return (e.exprType == EXPR_TERM && e.termNode.termType == TERM_IDENT) || e.exprType == EXPR_MEMBER || e.exprType == EXPR_INDEX
+}
+
+// isArrayLiteral reports whether the expression is an array literal, whose
+// type can come from where it is used.
+func (e ExprNode) isArrayLiteral() bool {
+	return e.exprType == EXPR_TERM && e.termNode.termType == TERM_ARRAY
+}
+
+func (e ExprNode) isMapLiteral() bool {
+	return e.exprType == EXPR_TERM && e.termNode.termType == TERM_MAP
+}
+
+// calleeName is the name of the method an expression calls, if it is a call.
+func (e ExprNode) calleeName() string {
+	if e.exprType == EXPR_MEMBER_CALL {
+		return e.memberNode.name
+	}
+	if e.exprType == EXPR_TERM && e.termNode.termType == TERM_CALL {
+		return e.termNode.callNode.methodName
+	}
+	return ""
+}
+
+// spelling returns how a binary operator is written in source.
+func (e ExprType) spelling() string {
+	for tokenType, operator := range binaryOperators {
+		if operator.exprType == e {
+			return tokenSpellings[tokenType]
+		}
+	}
+	return string(e)
+}
+
+// isConstant reports whether the expression is built only from literals.
+func (e ExprNode) isConstant() bool {
+	switch e.exprType {
+	case EXPR_TERM:
+		termType := e.termNode.termType
+		return termType == TERM_INT || termType == TERM_BOOL || termType == TERM_STRING
+	case EXPR_NEGATE, EXPR_NOT:
+		return e.exprUnaryNode.operand.isConstant()
+	case EXPR_MEMBER, EXPR_MEMBER_CALL, EXPR_INDEX:
+		return false
+	}
+	return e.exprBinaryNode.lhs.isConstant() && e.exprBinaryNode.rhs.isConstant()
+}
+
+// bindArguments matches call arguments to the method's parameters, filling
+// in default values for trailing parameters the caller left out. It returns
+// false when the number of arguments does not fit the signature.
+func (m MethodNode) bindArguments(arguments []ExprNode) ([]ExprNode, bool) {
+	if len(arguments) > len(m.parameters) {
+		return nil, false
+	}
+	bound := append([]ExprNode{}, arguments...)
+	for _, paramNode := range m.parameters[len(arguments):] {
+		if paramNode.defaultValue == nil {
+			return nil, false
+		}
+		bound = append(bound, *paramNode.defaultValue)
+	}
+	return bound, true
+}
+
+func (m MethodNode) describeArity() string {
+	required := 0
+	for _, paramNode := range m.parameters {
+		if paramNode.defaultValue == nil {
+			required++
+		}
+	}
+	if required == len(m.parameters) {
+		return fmt.Sprintf("%d argument(s)", required)
+	}
+	return fmt.Sprintf("%d to %d arguments", required, len(m.parameters))
+}
+
+// alwaysReturns reports whether every path through the block ends in a
+// return statement.
+func (b BlockNode) alwaysReturns() bool {
+	for _, instNode := range b.instructions {
+		switch instNode.instType {
+		case INST_RETURN:
+			return true
+		case INST_IF:
+			ifNode := instNode.ifNode
+			if ifNode.ifBlockNode.alwaysReturns() && ifNode.elseBlockNode.alwaysReturns() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getMethods returns the methods declared directly inside the block.
+func (b BlockNode) getMethods() map[string]MethodNode {
+	methods := make(map[string]MethodNode)
+	for _, instNode := range b.instructions {
+		if instNode.instType == INST_METHOD {
+			methods[instNode.methodNode.methodName] = instNode.methodNode
+		}
+	}
+	return methods
+}
+
 func (b BlockNode) getVarNames() []string {
 	varNames := []string{}
+	for _, instNode := range b.instructions {
+		if instNode.instType == INST_ASSIGN {
+			varNames = append(varNames, instNode.assignNode.identifier)
+		}
+	}
 	return varNames
 }
 
-func newParser(tokens []Token) Parser {
-	return Parser{tokens, 0}
+func newParser(tokens []Token, diags *Diagnostics) Parser {
+	return Parser{tokens, 0, diags, 0, false}
+}
+
+func (p *Parser) fail(span Span, code string, format string, args ...any) {
+	// Unwinding out of nested blocks can hit the same error more than once.
+	reported := p.diags.diagnostics
+	if len(reported) == 0 || reported[len(reported)-1].span != span || reported[len(reported)-1].code != code {
+		p.diags.error(span, code, format, args...)
+	}
+	panic(parseError{})
 }
 
 func (p Parser) parserCurrent() Token {
 	if p.index < len(p.tokens) {
 		return p.tokens[p.index]
 	}
-	return Token{tokenType: END}
+	return Token{tokenType: END, span: Span{p.previousEnd(), p.previousEnd()}}
+}
+
+// previousEnd is the position just after the last consumed token.
+func (p Parser) previousEnd() Position {
+	if p.index == 0 || len(p.tokens) == 0 {
+		return Position{0, 1, 1}
+	}
+	return p.tokens[min(p.index, len(p.tokens))-1].span.end
+}
+
+func (p Parser) spanFrom(start Span) Span {
+	return Span{start.start, p.previousEnd()}
+}
+
+func (p Parser) peek() Token {
+	p.index++
+	return p.parserCurrent()
 }
 
 func (p *Parser) parserAdvance() {
 	if p.index >= len(p.tokens) {
-		panic("Error finished all tokens")
+		p.fail(p.parserCurrent().span, ERR_UNEXPECTED_EOF, "unexpected end of file")
 	}
 	p.index++
 }
 
-func (p *Parser) parseParameters() map[string]string {
-	parameters := make(map[string]string)
+func (p *Parser) expect(tokenType TokenType) Token {
 	token := p.parserCurrent()
-	var key string
-	var val string
-	for token.tokenType != CLOSE_PAREN {
-		p.parserAdvance()
-		key = p.parserCurrent().value
-		p.parserAdvance()
-		if p.parserCurrent().tokenType != COLON {
-			panic("Expected : in method parameter decleration")
+	if token.tokenType != tokenType {
+		expected := string(tokenType)
+		if spelling, ok := tokenSpellings[tokenType]; ok {
+			expected = "`" + spelling + "`"
+		}
+		p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected %s but found %s", strings.ToLower(expected), token.describe())
+	}
+	p.parserAdvance()
+	return token
+}
+
+// synchronize skips tokens after a syntax error until the start of the next
+// statement, stepping over whole blocks so their contents are not reparsed.
+func (p *Parser) synchronize(startIndex int) {
+	if p.index == startIndex && p.index < len(p.tokens) {
+		p.index++
+	}
+	depth := 0
+	for p.index < len(p.tokens) {
+		switch p.parserCurrent().tokenType {
+		case BLOCK_START:
+			depth++
+		case BLOCK_END:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.index++
+				continue
+			}
+		case LET, IF, PRINT, METHOD, CLASS, INTERFACE, RETURN, WHILE, FOR, BREAK, CONTINUE:
+			if depth == 0 {
+				return
+			}
+		}
+		p.index++
+	}
+}
+
+func (p *Parser) parseParameters() []ParamNode {
+	parameters := []ParamNode{}
+	seen := make(map[string]bool)
+	for p.parserCurrent().tokenType != CLOSE_PAREN {
+		paramNode := ParamNode{}
+		start := p.parserCurrent().span
+		paramNode.name = p.expect(IDENTIFIER).value
+		p.expect(COLON)
+		paramNode.typeName = p.parseType()
+		if p.parserCurrent().tokenType == EQUAL {
+			p.parserAdvance()
+			defaultValue := p.parseExpr()
+			paramNode.defaultValue = &defaultValue
+			if !defaultValue.isConstant() {
+				p.diags.error(defaultValue.span, ERR_DEFAULT_NOT_CONSTANT, "default value of `%s` must be a constant expression", paramNode.name)
+			}
+		}
+		paramNode.span = p.spanFrom(start)
+
+		if seen[paramNode.name] {
+			p.diags.error(paramNode.span, ERR_REDECLARED, "duplicate parameter `%s`", paramNode.name)
+		}
+		seen[paramNode.name] = true
+		if len(parameters) > 0 && parameters[len(parameters)-1].defaultValue != nil && paramNode.defaultValue == nil {
+			p.diags.error(paramNode.span, ERR_DEFAULT_ORDER, "parameter `%s` without a default value follows one with a default value", paramNode.name)
+		}
+		parameters = append(parameters, paramNode)
+
+		if p.parserCurrent().tokenType != CLOSE_PAREN {
+			p.expect(COMMA)
 		}
-		p.parserAdvance()
-		val = p.parserCurrent().value
-		parameters[key] = val
-		p.parserAdvance()
-		token = p.parserCurrent()
 	}
 	p.parserAdvance()
 
@@ -169,63 +602,194 @@ func (p *Parser) parseParameters() map[string]string {
 func (p *Parser) parseTerm() TermNode {
 	token := p.parserCurrent()
 	termNode := TermNode{}
+	termNode.span = token.span
 	if token.tokenType == INPUT {
+		p.parserAdvance()
 		termNode.termType = TERM_INPUT
+		termNode.value = "int"
+		if p.parserCurrent().tokenType == OPEN_PAREN {
+			p.parserAdvance()
+			termNode.value = p.expect(IDENTIFIER).value
+			p.expect(CLOSE_PAREN)
+		}
+		termNode.span = p.spanFrom(token.span)
+		return termNode
 	} else if token.tokenType == INT {
 		termNode.termType = TERM_INT
 		termNode.value = token.value
+		limit := int64(math.MaxInt32)
+		if p.negated {
+			limit = -math.MinInt32
+			p.negated = false
+		}
+		if v, err := strconv.ParseInt(token.value, 10, 64); err != nil || v > limit {
+			p.diags.error(token.span, ERR_INT_OUT_OF_RANGE, "integer literal `%s` does not fit in an int", token.value)
+		}
+	} else if token.tokenType == STRING {
+		termNode.termType = TERM_STRING
+		termNode.value = token.value
+	} else if token.tokenType == TRUE || token.tokenType == FALSE {
+		termNode.termType = TERM_BOOL
+		termNode.value = tokenSpellings[token.tokenType]
+	} else if token.tokenType == IDENTIFIER && p.peek().tokenType == OPEN_PAREN {
+		termNode.termType = TERM_CALL
+		termNode.callNode = p.parseCall()
+		termNode.span = termNode.callNode.span
+		return termNode
 	} else if token.tokenType == IDENTIFIER {
 		termNode.termType = TERM_IDENT
 		termNode.value = token.value
+	} else if token.tokenType == OPEN_BRACKET {
+		p.parserAdvance()
+		termNode.termType = TERM_ARRAY
+		termNode.elements = []ExprNode{}
+		for p.parserCurrent().tokenType != CLOSE_BRACKET {
+			termNode.elements = append(termNode.elements, p.parseExpr())
+			if p.parserCurrent().tokenType != CLOSE_BRACKET {
+				p.expect(COMMA)
+			}
+		}
+		p.parserAdvance()
+		termNode.span = p.spanFrom(token.span)
+		return termNode
+	} else if token.tokenType == BLOCK_START {
+		p.parserAdvance()
+		termNode.termType = TERM_MAP
+		termNode.elements = []ExprNode{}
+		termNode.values = []ExprNode{}
+		for p.parserCurrent().tokenType != BLOCK_END {
+			termNode.elements = append(termNode.elements, p.parseExpr())
+			p.expect(COLON)
+			termNode.values = append(termNode.values, p.parseExpr())
+			if p.parserCurrent().tokenType != BLOCK_END {
+				p.expect(COMMA)
+			}
+		}
+		p.parserAdvance()
+		termNode.span = p.spanFrom(token.span)
+		return termNode
 	} else {
-		panic("Expected a term (input, int or ident) but found " + token.tokenType)
+		p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected an expression but found %s", token.describe())
 	}
 	p.parserAdvance()
 	return termNode
 }
 
+func (p *Parser) parseCall() CallNode {
+	callNode := CallNode{}
+	start := p.parserCurrent().span
+	callNode.methodName = p.expect(IDENTIFIER).value
+	p.expect(OPEN_PAREN)
+	for p.parserCurrent().tokenType != CLOSE_PAREN {
+		callNode.arguments = append(callNode.arguments, p.parseExpr())
+		if p.parserCurrent().tokenType != CLOSE_PAREN {
+			p.expect(COMMA)
+		}
+	}
+	p.parserAdvance()
+	callNode.span = p.spanFrom(start)
+	return callNode
+}
+
 func (p *Parser) parseExpr() ExprNode {
+	return p.parseBinary(1)
+}
+
+// parseBinary parses operators binding at least as tightly as minPrecedence
+// using precedence climbing.
+func (p *Parser) parseBinary(minPrecedence int) ExprNode {
+	exprNode := p.parseUnary()
+	for {
+		operator, ok := binaryOperators[p.parserCurrent().tokenType]
+		if !ok || operator.precedence < minPrecedence {
+			return exprNode
+		}
+		p.parserAdvance()
+		lhs := exprNode
+		rhs := p.parseBinary(operator.precedence + 1)
+		exprNode = ExprNode{}
+		exprNode.exprType = operator.exprType
+		exprNode.exprBinaryNode.lhs = &lhs
+		exprNode.exprBinaryNode.rhs = &rhs
+		exprNode.exprBinaryNode.span = spanBetween(lhs.span, rhs.span)
+		exprNode.span = exprNode.exprBinaryNode.span
+	}
+}
+
+func (p *Parser) parseUnary() ExprNode {
 	exprNode := ExprNode{}
-	lhs := p.parseTerm()
 	token := p.parserCurrent()
-
-	if token.tokenType == PLUS {
+	switch token.tokenType {
+	case MINUS, NOT:
 		p.parserAdvance()
-		rhs := p.parseTerm()
-		exprNode.exprType = EXPR_PLUS
-		exprNode.termBinaryNode.lhs = lhs
-		exprNode.termBinaryNode.rhs = rhs
-	} else {
-		exprNode.exprType = EXPR_TERM
-		exprNode.termNode = lhs
+		p.negated = token.tokenType == MINUS && p.parserCurrent().tokenType == INT
+		operand := p.parseUnary()
+		exprNode.exprType = EXPR_NEGATE
+		if token.tokenType == NOT {
+			exprNode.exprType = EXPR_NOT
+		}
+		exprNode.exprUnaryNode.operand = &operand
+		exprNode.exprUnaryNode.span = p.spanFrom(token.span)
+	default:
+		return p.parsePostfix()
 	}
+	exprNode.span = p.spanFrom(token.span)
 	return exprNode
 }
 
-func (p *Parser) parseRel() RelNode {
-	relNode := RelNode{}
-	lhs := p.parseTerm()
+// parsePostfix parses a term or parenthesised expression followed by any
+// number of `.field` accesses, `.method(...)` calls and `[index]` accesses.
+func (p *Parser) parsePostfix() ExprNode {
+	exprNode := ExprNode{}
 	token := p.parserCurrent()
-
-	if token.tokenType == LESS_THAN {
+	if token.tokenType == OPEN_PAREN {
 		p.parserAdvance()
-		rhs := p.parseTerm()
-		relNode.relType = REL_LESS_THAN
-		relNode.termBinaryNode.lhs = lhs
-		relNode.termBinaryNode.rhs = rhs
+		exprNode = p.parseExpr()
+		p.expect(CLOSE_PAREN)
 	} else {
-		panic("Expected relational (<) found " + token.tokenType)
+		exprNode.exprType = EXPR_TERM
+		exprNode.termNode = p.parseTerm()
 	}
-	return relNode
+	exprNode.span = p.spanFrom(token.span)
+
+	for p.parserCurrent().tokenType == DOT || p.parserCurrent().tokenType == OPEN_BRACKET {
+		if p.parserCurrent().tokenType == OPEN_BRACKET {
+			p.parserAdvance()
+			array := exprNode
+			index := p.parseExpr()
+			p.expect(CLOSE_BRACKET)
+			exprNode = ExprNode{exprType: EXPR_INDEX, span: p.spanFrom(token.span)}
+			exprNode.indexNode = IndexNode{&array, &index, exprNode.span}
+			continue
+		}
+		p.parserAdvance()
+		object := exprNode
+		exprNode = ExprNode{exprType: EXPR_MEMBER}
+		exprNode.memberNode.object = &object
+		if p.peek().tokenType == OPEN_PAREN {
+			exprNode.exprType = EXPR_MEMBER_CALL
+			exprNode.memberNode.callNode = p.parseCall()
+			exprNode.memberNode.name = exprNode.memberNode.callNode.methodName
+		} else {
+			exprNode.memberNode.name = p.expect(IDENTIFIER).value
+		}
+		exprNode.memberNode.span = p.spanFrom(token.span)
+		exprNode.span = exprNode.memberNode.span
+	}
+	return exprNode
 }
 
 func (p *Parser) parseBlock() BlockNode {
 	blockNode := BlockNode{}
+	start := p.expect(BLOCK_START).span
 	currentNode := p.parserCurrent()
 	for {
 		if currentNode.tokenType == BLOCK_END {
 			p.parserAdvance()
+			blockNode.span = p.spanFrom(start)
 			return blockNode
+		} else if currentNode.tokenType == END {
+			p.fail(currentNode.span, ERR_UNEXPECTED_EOF, "expected `}` before end of file")
 		} else {
 			instNode := p.parseInst()
 			if instNode.instType != "" {
@@ -236,146 +800,348 @@ func (p *Parser) parseBlock() BlockNode {
 	}
 }
 
-func (p *Parser) checkTypeValid(typeName string) {
-	primitaveTypes := []string{"int", "string"}
-	// TODO: add more primitaves and user types
-	if !slices.Contains(primitaveTypes, typeName) {
-		panic("Unknown type: " + typeName)
-	}
-}
-
+// parseAssign parses `let type name = expr`, or `let name = expr` when the
+// type is left to be inferred.
 func (p *Parser) parseAssign() InstNode {
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	token := p.parserCurrent()
 	instNode := InstNode{}
 	instNode.instType = INST_ASSIGN
-	instNode.assignNode.typeName = token.value
-	p.checkTypeValid(token.value)
-	p.parserAdvance()
-	token = p.parserCurrent()
-	instNode.assignNode.identifier = token.value
-	p.parserAdvance()
-	token = p.parserCurrent()
-	if token.tokenType != EQUAL {
-		panic("Expected equal but found " + token.tokenType)
+	if p.peek().tokenType != EQUAL {
+		instNode.assignNode.typeName = p.parseType()
+	}
+	instNode.assignNode.identifier = p.expect(IDENTIFIER).value
+	if instNode.assignNode.typeName == "" || p.parserCurrent().tokenType == EQUAL {
+		p.expect(EQUAL)
+		instNode.assignNode.expr = p.parseExpr()
+	}
+	instNode.assignNode.span = p.spanFrom(start)
+	return instNode
+}
+
+// parseType parses a type name: a named type, a fixed size array such as
+// `int[10]`, a growable array such as `[]int` or a map such as
+// `map[string]int`. The type is returned in that same spelling for the
+// checker to interpret.
+func (p *Parser) parseType() string {
+	if p.parserCurrent().tokenType == OPEN_BRACKET {
+		p.parserAdvance()
+		p.expect(CLOSE_BRACKET)
+		return "[]" + p.parseType()
+	}
+	if token := p.parserCurrent(); token.tokenType == IDENTIFIER && token.value == "map" && p.peek().tokenType == OPEN_BRACKET {
+		p.parserAdvance()
+		p.parserAdvance()
+		keyName := p.parseType()
+		p.expect(CLOSE_BRACKET)
+		return "map[" + keyName + "]" + p.parseType()
+	}
+	typeName := p.expect(IDENTIFIER).value
+	for p.parserCurrent().tokenType == OPEN_BRACKET {
+		p.parserAdvance()
+		typeName += "[" + p.expect(INT).value + "]"
+		p.expect(CLOSE_BRACKET)
+	}
+	return typeName
+}
+
+// parseExprStatement parses a statement that starts with an expression:
+// an assignment to a variable or field, or a call made for its effects.
+func (p *Parser) parseExprStatement() InstNode {
+	instNode := InstNode{}
+	start := p.parserCurrent().span
+	target := p.parsePostfix()
+	token := p.parserCurrent()
+	operator, compound := compoundOperators[token.tokenType]
+	if !compound && token.tokenType != EQUAL {
+		if target.calleeName() == "" {
+			p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected an assignment but found %s", token.describe())
+		}
+		instNode.instType = INST_CALL
+		instNode.exprNode = target
+		return instNode
+	}
+	if !target.isAssignable() {
+		p.diags.error(target.span, ERR_NOT_ASSIGNABLE, "cannot assign to this expression")
 	}
 	p.parserAdvance()
-	instNode.assignNode.expr = p.parseExpr()
+	instNode.instType = INST_REASSIGN
+	instNode.reassignNode.target = target
+	instNode.reassignNode.operator = operator
+	instNode.reassignNode.expr = p.parseExpr()
+	instNode.reassignNode.span = p.spanFrom(start)
 	return instNode
 }
 
 func (p *Parser) parseIf() InstNode {
 	instNode := InstNode{}
 	instNode.instType = INST_IF
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	instNode.ifNode.relNode = p.parseRel()
-	token := p.parserCurrent()
-	if token.tokenType == BLOCK_START {
-		p.parserAdvance()
-		instNode.ifNode.ifBlockNode = p.parseBlock()
-	}
+	instNode.ifNode.condNode = p.parseExpr()
+	instNode.ifNode.ifBlockNode = p.parseBlock()
 	if p.parserCurrent().tokenType == ELSE {
 		p.parserAdvance()
-		if token.tokenType == BLOCK_START {
-			p.parserAdvance()
-			instNode.ifNode.elseBlockNode = p.parseBlock()
-		}
+		instNode.ifNode.elseBlockNode = p.parseBlock()
 	}
+	instNode.ifNode.span = p.spanFrom(start)
 	return instNode
 }
 
 func (p *Parser) parsePrint() InstNode {
 	instNode := InstNode{}
 	instNode.instType = INST_PRINT
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	instNode.printNode.termNode = p.parseTerm()
+	instNode.printNode.exprNode = p.parseExpr()
+	instNode.printNode.span = p.spanFrom(start)
 	return instNode
 }
 
 func (p *Parser) parseClass() InstNode {
 	instNode := InstNode{}
 	instNode.instType = INST_CLASS
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	nameToken := p.parserCurrent()
+	classNode := &instNode.classNode
+	classNode.className = p.expect(IDENTIFIER).value
+	if p.parserCurrent().tokenType == COLON {
+		p.parserAdvance()
+		classNode.supertypes = append(classNode.supertypes, p.expect(IDENTIFIER).value)
+		for p.parserCurrent().tokenType == COMMA {
+			p.parserAdvance()
+			classNode.supertypes = append(classNode.supertypes, p.expect(IDENTIFIER).value)
+		}
+	}
+	p.expect(BLOCK_START)
+	for p.parserCurrent().tokenType != BLOCK_END {
+		token := p.parserCurrent()
+		switch token.tokenType {
+		case LET:
+			fieldNode := p.parseField()
+			classNode.fields = append(classNode.fields, fieldNode)
+			classNode.varNames = append(classNode.varNames, fieldNode.name)
+		case METHOD:
+			methodNode := p.parseMethod().methodNode
+			methodNode.className = classNode.className
+			classNode.methods = append(classNode.methods, methodNode)
+			classNode.functionNames = append(classNode.functionNames, methodNode.methodName)
+		case END:
+			p.fail(token.span, ERR_UNEXPECTED_EOF, "unexpected end of file, expected `}`")
+		default:
+			p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected a field or method but found %s", token.describe())
+		}
+	}
 	p.parserAdvance()
-	classBlockNode := p.parseBlock()
-	instNode.classNode.blockNode = classBlockNode
-	instNode.classNode.className = nameToken.value
-	instNode.classNode.functionNames = classBlockNode.getFunctionNames()
-	instNode.classNode.varNames = classBlockNode.getVarNames()
+	classNode.span = p.spanFrom(start)
 	return instNode
 }
 
+// parseField parses `let type name`, `let type name = expr` or
+// `let name = expr` inside a class.
+func (p *Parser) parseField() FieldNode {
+	fieldNode := FieldNode{}
+	start := p.parserCurrent().span
+	p.parserAdvance()
+	if next := p.peek().tokenType; next == IDENTIFIER || next == OPEN_BRACKET || p.parserCurrent().tokenType == OPEN_BRACKET {
+		fieldNode.typeName = p.parseType()
+	}
+	fieldNode.name = p.expect(IDENTIFIER).value
+	if p.parserCurrent().tokenType == EQUAL {
+		p.parserAdvance()
+		initializer := p.parseExpr()
+		fieldNode.initializer = &initializer
+	} else if fieldNode.typeName == "" {
+		p.fail(p.parserCurrent().span, ERR_UNEXPECTED_TOKEN, "expected a type or initial value for field `%s`", fieldNode.name)
+	}
+	fieldNode.span = p.spanFrom(start)
+	return fieldNode
+}
+
 func (p *Parser) parseMethod() InstNode {
 	instNode := InstNode{}
 	instNode.instType = INST_METHOD
+	start := p.parserCurrent().span
+	instNode.methodNode = p.parseSignature()
+
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	methodBlockNode := p.parseBlock()
+	p.loopDepth = loopDepth
+	instNode.methodNode.blockNode = methodBlockNode
+	instNode.methodNode.varNames = methodBlockNode.getVarNames()
+	instNode.methodNode.span = p.spanFrom(start)
+	return instNode
+}
+
+// parseSignature parses `method name(params): returnType` up to the body.
+func (p *Parser) parseSignature() MethodNode {
+	methodNode := MethodNode{}
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	nameToken := p.parserCurrent()
-	p.parserAdvance()
-	if p.parserCurrent().tokenType == OPEN_PAREN {
-		p.parserAdvance()
-		instNode.methodNode.parameters = p.parseParameters()
-	} else {
-		panic("Expected ( in method definition")
-	}
+	methodNode.methodName = p.expect(IDENTIFIER).value
+	p.expect(OPEN_PAREN)
+	methodNode.parameters = p.parseParameters()
 	if p.parserCurrent().tokenType == COLON {
 		p.parserAdvance()
-		instNode.methodNode.returnType = p.parserCurrent().value
-		p.parserAdvance()
+		methodNode.returnType = p.parseType()
 	} else {
-		instNode.methodNode.returnType = "void"
+		methodNode.returnType = "void"
 	}
+	methodNode.span = p.spanFrom(start)
+	return methodNode
+}
 
-	methodBlockNode := p.parseBlock()
-	instNode.methodNode.blockNode = methodBlockNode
-	instNode.methodNode.methodName = nameToken.value
-	instNode.methodNode.varNames = methodBlockNode.getVarNames()
+func (p *Parser) parseInterface() InstNode {
+	instNode := InstNode{}
+	instNode.instType = INST_INTERFACE
+	start := p.parserCurrent().span
+	p.parserAdvance()
+	interfaceNode := &instNode.interfaceNode
+	interfaceNode.name = p.expect(IDENTIFIER).value
+	p.expect(BLOCK_START)
+	for p.parserCurrent().tokenType != BLOCK_END {
+		token := p.parserCurrent()
+		switch token.tokenType {
+		case METHOD:
+			methodNode := p.parseSignature()
+			methodNode.className = interfaceNode.name
+			interfaceNode.methods = append(interfaceNode.methods, methodNode)
+		case END:
+			p.fail(token.span, ERR_UNEXPECTED_EOF, "unexpected end of file, expected `}`")
+		default:
+			p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected a method signature but found %s", token.describe())
+		}
+	}
+	p.parserAdvance()
+	interfaceNode.span = p.spanFrom(start)
 	return instNode
 }
 
 func (p *Parser) parseReturn() InstNode {
 	instNode := InstNode{}
 	instNode.instType = INST_RETURN
+	start := p.parserCurrent().span
 	p.parserAdvance()
-	instNode.returnNode.exprNode = p.parseExpr()
+	if p.parserCurrent().tokenType != BLOCK_END {
+		instNode.returnNode.exprNode = p.parseExpr()
+	}
+	instNode.returnNode.span = p.spanFrom(start)
 	return instNode
 }
 
-func (p *Parser) parseInst() InstNode {
-	var token Token
-	var instNode InstNode
-	token = p.parserCurrent()
+func (p *Parser) parseWhile() InstNode {
+	instNode := InstNode{}
+	instNode.instType = INST_WHILE
+	start := p.parserCurrent().span
+	p.parserAdvance()
+	instNode.whileNode.condNode = p.parseExpr()
+	instNode.whileNode.blockNode = p.parseLoopBlock()
+	instNode.whileNode.span = p.spanFrom(start)
+	return instNode
+}
+
+func (p *Parser) parseFor() InstNode {
+	instNode := InstNode{}
+	instNode.instType = INST_FOR
+	start := p.parserCurrent().span
+	p.parserAdvance()
+	instNode.forNode.identifier = p.expect(IDENTIFIER).value
+	p.expect(IN)
+	first := p.parseExpr()
+	if p.parserCurrent().tokenType == DOT_DOT {
+		p.parserAdvance()
+		instNode.forNode.startNode = first
+		instNode.forNode.endNode = p.parseExpr()
+	} else {
+		instNode.forNode.arrayNode = first
+	}
+	instNode.forNode.blockNode = p.parseLoopBlock()
+	instNode.forNode.span = p.spanFrom(start)
+	return instNode
+}
+
+func (p *Parser) parseLoopBlock() BlockNode {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlock()
+}
+
+// parseLoopControl parses break and continue, which are only meaningful
+// inside the body of a loop.
+func (p *Parser) parseLoopControl(instType InstType) InstNode {
+	instNode := InstNode{}
+	instNode.instType = instType
+	token := p.parserCurrent()
+	p.parserAdvance()
+	if p.loopDepth == 0 {
+		p.diags.error(token.span, ERR_OUTSIDE_LOOP, "%s outside of a loop", token.describe())
+	}
+	return instNode
+}
+
+// parseInst parses a single statement. A syntax error anywhere inside it is
+// reported, the parser resynchronises at the next statement and an empty
+// InstNode is returned so that parsing can carry on.
+func (p *Parser) parseInst() (instNode InstNode) {
+	token := p.parserCurrent()
+	startIndex := p.index
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parseError); !ok {
+				panic(r)
+			}
+			instNode = InstNode{}
+			p.synchronize(startIndex)
+		}
+	}()
+
 	switch token.tokenType {
 	case LET:
 		instNode = p.parseAssign()
+	case IDENTIFIER, OPEN_PAREN:
+		instNode = p.parseExprStatement()
 	case IF:
 		instNode = p.parseIf()
 	case PRINT:
 		instNode = p.parsePrint()
 	case CLASS:
 		instNode = p.parseClass()
+	case INTERFACE:
+		instNode = p.parseInterface()
 	case METHOD:
 		instNode = p.parseMethod()
 	case RETURN:
 		instNode = p.parseReturn()
+	case WHILE:
+		instNode = p.parseWhile()
+	case FOR:
+		instNode = p.parseFor()
+	case BREAK:
+		instNode = p.parseLoopControl(INST_BREAK)
+	case CONTINUE:
+		instNode = p.parseLoopControl(INST_CONTINUE)
+	case END:
+		p.fail(token.span, ERR_UNEXPECTED_EOF, "unexpected end of file")
 	default:
-		p.parserAdvance()
+		p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected a statement but found %s", token.describe())
 	}
+	instNode.span = p.spanFrom(token.span)
 	return instNode
 }
 
 func (p *Parser) parseProgram() ProgramNode {
-	programNode := ProgramNode{[]InstNode{}, "test.yeol"}
+	programNode := ProgramNode{instructions: []InstNode{}, fileName: p.diags.fileName}
+	start := p.parserCurrent().span
 
 	var instNode InstNode
 	for p.index < len(p.tokens) {
 		instNode = p.parseInst()
-		// fmt.Println(instNode.instType)
 		if instNode.instType != "" {
-			// fmt.Println(instNode.instType)
 			programNode.instructions = append(programNode.instructions, instNode)
 		}
 	}
+	programNode.span = p.spanFrom(start)
 
 	return programNode
 }
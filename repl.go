@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const replFileName = "<repl>"
+
+// Repl reads entries, a line or a block of statements, and runs them with
+// the interpreter. Every entry is analysed together with the entries
+// accepted before it, so that it sees their variables, methods and classes,
+// and only its own statements are run.
+type Repl struct {
+	in          *bufio.Reader
+	out         *bufio.Writer
+	interpreter *Interpreter
+	// tokens holds the accepted entries and executed the number of their
+	// top-level statements that already ran.
+	tokens   []Token
+	executed int
+	// seen holds the warnings already shown, which would otherwise be
+	// reported again for every entry that follows them.
+	seen map[Diagnostic]bool
+}
+
+func newRepl(in io.Reader, out io.Writer) *Repl {
+	r := &Repl{in: bufio.NewReader(in), seen: map[Diagnostic]bool{}}
+	// The interpreter shares the reader so that input reads the lines that
+	// follow the entry.
+	r.interpreter = newInterpreter(ProgramNode{fileName: replFileName}, r.in, out)
+	r.out = r.interpreter.out
+	return r
+}
+
+// run reads entries until the end of the input or a return at the top
+// level, and returns the exit status.
+func (r *Repl) run() int {
+	for {
+		entry, ok := r.readEntry()
+		if !ok {
+			fmt.Fprintln(r.out)
+			r.out.Flush()
+			return 0
+		}
+		if status, exited := r.runEntry(strings.TrimSpace(entry)); exited {
+			return status
+		}
+	}
+}
+
+// readEntry reads lines until every block they open is closed.
+func (r *Repl) readEntry() (string, bool) {
+	var sb strings.Builder
+	prompt := "yeol> "
+	for {
+		fmt.Fprint(r.out, prompt)
+		r.out.Flush()
+		line, err := r.in.ReadString('\n')
+		sb.WriteString(line)
+		if err != nil {
+			return sb.String(), sb.Len() > 0
+		}
+		if openBlocks(sb.String()) <= 0 {
+			return sb.String(), true
+		}
+		prompt = "...   "
+	}
+}
+
+func openBlocks(source string) int {
+	depth := 0
+	for _, token := range newLexer(source, newDiagnostics(replFileName, source)).tokenize() {
+		switch token.tokenType {
+		case BLOCK_START:
+			depth++
+		case BLOCK_END:
+			depth--
+		}
+	}
+	return depth
+}
+
+func (r *Repl) runEntry(entry string) (status int, exited bool) {
+	command, argument, _ := strings.Cut(entry, " ")
+	switch {
+	case entry == "":
+	case command == ":reset":
+		r.tokens, r.executed = nil, 0
+		r.interpreter.frame = nil
+		r.seen = map[Diagnostic]bool{}
+	case command == ":type":
+		if _, exprNode, ok := r.analyzeExpr(strings.TrimSpace(argument)); ok {
+			fmt.Fprintln(r.out, exprNode.valueType)
+		}
+	case command == ":ast":
+		source := strings.TrimSpace(argument)
+		diags := newDiagnostics(replFileName, source)
+		exprNode, _ := parseExpression(newLexer(source, diags).tokenize(), diags)
+		if !r.report(diags) {
+			fmt.Fprint(r.out, formatExprTree(exprNode))
+		}
+	case strings.HasPrefix(command, ":"):
+		fmt.Fprintf(os.Stderr, "unknown command %s, expected :type, :ast or :reset\n", command)
+	default:
+		return r.runSource(entry)
+	}
+	r.out.Flush()
+	return 0, false
+}
+
+// runSource prints the value of an entry that is an expression, and runs
+// the statements of any other entry.
+func (r *Repl) runSource(source string) (status int, exited bool) {
+	diags := newDiagnostics(replFileName, source)
+	tokens := newLexer(source, diags).tokenize()
+	if r.report(diags) {
+		return 0, false
+	}
+	if _, ok := parseExpression(tokens, newDiagnostics(replFileName, source)); ok {
+		programNode, exprNode, ok := r.analyzeExpr(source)
+		if !ok {
+			return 0, false
+		}
+		var value any
+		r.interpreter.programNode = programNode
+		status, _ := r.interpreter.guard(func() {
+			value = r.interpreter.eval(exprNode)
+		})
+		if status == 0 && exprNode.valueType.kind != TYPE_VOID {
+			fmt.Fprintln(r.out, formatValue(value, exprNode.valueType, map[*object]bool{}))
+			r.out.Flush()
+		}
+		return 0, false
+	}
+
+	tokens = append(slices.Clip(r.tokens), tokens...)
+	p := newParser(tokens, diags)
+	programNode := p.parseProgram()
+	if r.report(diags) || !r.analyze(&programNode, diags) {
+		return 0, false
+	}
+	i := r.interpreter
+	i.programNode = programNode
+	if n := programNode.locals - len(i.frame); n > 0 {
+		i.frame = append(i.frame, make([]any, n)...)
+	}
+	status, exited = i.guard(func() {
+		i.runBlock(BlockNode{instructions: programNode.instructions[r.executed:]})
+	})
+	// An entry that stopped with a runtime error is forgotten, since the
+	// variables it declares after the error were never set.
+	if status == 0 {
+		r.tokens = tokens
+		r.executed = len(programNode.instructions)
+	}
+	return status, exited
+}
+
+// analyzeExpr checks an expression against the accepted entries. It is
+// added to their program as a statement of its own.
+func (r *Repl) analyzeExpr(source string) (ProgramNode, ExprNode, bool) {
+	diags := newDiagnostics(replFileName, source)
+	exprNode, ok := parseExpression(newLexer(source, diags).tokenize(), diags)
+	if r.report(diags) || !ok {
+		return ProgramNode{}, ExprNode{}, false
+	}
+	p := newParser(r.tokens, diags)
+	programNode := p.parseProgram()
+	programNode.instructions = append(programNode.instructions, InstNode{instType: INST_CALL, exprNode: exprNode, span: exprNode.span})
+	if !r.analyze(&programNode, diags) {
+		return ProgramNode{}, ExprNode{}, false
+	}
+	return programNode, programNode.instructions[len(programNode.instructions)-1].exprNode, true
+}
+
+func (r *Repl) analyze(programNode *ProgramNode, diags *Diagnostics) bool {
+	resolver := newResolver(diags)
+	resolver.resolveProgram(programNode)
+	if r.report(diags) {
+		return false
+	}
+	c := newChecker(diags)
+	c.checkProgram(programNode)
+	return !r.report(diags)
+}
+
+// report writes the diagnostics to stderr, leaving out the warnings that
+// were shown before, and tells whether any of them is an error.
+func (r *Repl) report(diags *Diagnostics) bool {
+	hasErrors := diags.hasErrors()
+	shown := newDiagnostics(diags.fileName, diags.source)
+	for _, diagnostic := range diags.diagnostics {
+		if !r.seen[diagnostic] {
+			shown.diagnostics = append(shown.diagnostics, diagnostic)
+		}
+		if diagnostic.severity == SEVERITY_WARNING {
+			r.seen[diagnostic] = true
+		}
+	}
+	r.out.Flush()
+	fmt.Fprint(os.Stderr, shown)
+	diags.diagnostics = []Diagnostic{}
+	return hasErrors
+}
+
+// parseExpression parses tokens that must hold a single expression.
+func parseExpression(tokens []Token, diags *Diagnostics) (exprNode ExprNode, ok bool) {
+	p := newParser(tokens, diags)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isParseError := r.(parseError); !isParseError {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	exprNode = p.parseExpr()
+	if token := p.parserCurrent(); token.tokenType != END {
+		p.fail(token.span, ERR_UNEXPECTED_TOKEN, "expected the end of the expression but found %s", token.describe())
+	}
+	return exprNode, !diags.hasErrors()
+}
+
+// formatValue writes a value the way a literal of its type would be written.
+// Objects show their fields, except inside themselves where they show as
+// `Name{...}`.
+func formatValue(v any, t *Type, visiting map[*object]bool) string {
+	switch v := v.(type) {
+	case int32:
+		return strconv.Itoa(int(v))
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return strconv.Quote(v)
+	case *array:
+		values := make([]string, len(v.elements))
+		for n, element := range v.elements {
+			values[n] = formatValue(element, t.elem, visiting)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case *hashMap:
+		values := []string{}
+		for n, state := range v.states {
+			if state == slotFull {
+				values = append(values, formatValue(v.keys[n], t.key, visiting)+": "+formatValue(v.values[n], t.elem, visiting))
+			}
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	case *object:
+		if visiting[v] {
+			return v.classNode.className + "{...}"
+		}
+		visiting[v] = true
+		defer delete(visiting, v)
+		fields := make([]string, len(v.fields))
+		for n, symbol := range v.classNode.layout {
+			fields[n] = symbol.name + ": " + formatValue(v.fields[n], symbol.valueType, visiting)
+		}
+		return v.classNode.className + "{" + strings.Join(fields, ", ") + "}"
+	}
+	return "<unset>"
+}
@@ -0,0 +1,450 @@
+package main
+
+type SymbolKind string
+
+const (
+	SYMBOL_VARIABLE  SymbolKind = "SYMBOL_VARIABLE"
+	SYMBOL_PARAMETER SymbolKind = "SYMBOL_PARAMETER"
+	SYMBOL_METHOD    SymbolKind = "SYMBOL_METHOD"
+	SYMBOL_CLASS     SymbolKind = "SYMBOL_CLASS"
+	SYMBOL_FIELD     SymbolKind = "SYMBOL_FIELD"
+	SYMBOL_INTERFACE SymbolKind = "SYMBOL_INTERFACE"
+	SYMBOL_BUILTIN   SymbolKind = "SYMBOL_BUILTIN"
+)
+
+// builtinArity lists the methods provided by the language itself and the
+// number of arguments each of them takes.
+var builtinArity = map[string]int{
+	"len":      1,
+	"push":     2,
+	"delete":   2,
+	"contains": 2,
+}
+
+// Symbol is a declared name. Variables and parameters own the frame slot
+// numbered slot in the method (or top level) that declares them; for a field
+// slot is its index in the object and for a method of a class its index in
+// the vtable.
+type Symbol struct {
+	name          string
+	kind          SymbolKind
+	typeName      string
+	slot          int
+	valueType     *Type
+	methodNode    *MethodNode
+	classNode     *ClassNode
+	interfaceNode *InterfaceNode
+	span          Span
+}
+
+type Scope struct {
+	parent  *Scope
+	symbols map[string]*Symbol
+	// pending holds the names declared further down the block, so that an
+	// early use is reported as such rather than as an unknown name.
+	pending map[string]bool
+	// frame marks the outermost scope of a method or of the top level.
+	// Variable lookups do not go past it.
+	frame bool
+}
+
+// Resolver binds every name in the program to its declaration and assigns
+// frame slots to variables. Both backends rely on the symbols it attaches.
+type Resolver struct {
+	diags   *Diagnostics
+	global  *Scope
+	program *Scope
+	scope   *Scope
+	locals  int
+	// inheriting holds the classes whose members are being collected, to
+	// catch classes that inherit from themselves.
+	inheriting map[*ClassNode]bool
+}
+
+func isVariable(symbol *Symbol) bool {
+	return symbol.kind == SYMBOL_VARIABLE || symbol.kind == SYMBOL_PARAMETER
+}
+
+func newScope(parent *Scope, frame bool) *Scope {
+	return &Scope{parent, make(map[string]*Symbol), make(map[string]bool), frame}
+}
+
+func newResolver(diags *Diagnostics) Resolver {
+	// Builtins live above the global scope so that a program can declare a
+	// method of the same name.
+	builtins := newScope(nil, false)
+	for name := range builtinArity {
+		builtins.symbols[name] = &Symbol{name: name, kind: SYMBOL_BUILTIN}
+	}
+	global := newScope(builtins, false)
+	return Resolver{diags: diags, global: global, program: newScope(global, true), inheriting: make(map[*ClassNode]bool)}
+}
+
+func (r *Resolver) resolveProgram(programNode *ProgramNode) {
+	r.scope = r.global
+	r.declareMembers(programNode.instructions)
+	for i := range programNode.instructions {
+		if programNode.instructions[i].instType == INST_CLASS {
+			r.declareClassMembers(&programNode.instructions[i].classNode)
+		}
+	}
+	r.scope = r.program
+	r.resolveInstructions(programNode.instructions)
+	programNode.locals = r.locals
+}
+
+// declareMembers hoists the methods and classes of a block so that they can
+// be used before their definition and call each other recursively.
+func (r *Resolver) declareMembers(instructions []InstNode) {
+	for i := range instructions {
+		instNode := &instructions[i]
+		switch instNode.instType {
+		case INST_METHOD:
+			methodNode := &instNode.methodNode
+			methodNode.symbol = &Symbol{name: methodNode.methodName, kind: SYMBOL_METHOD, typeName: methodNode.returnType, methodNode: methodNode, span: methodNode.span}
+			r.declare(methodNode.symbol)
+		case INST_CLASS:
+			classNode := &instNode.classNode
+			classNode.symbol = &Symbol{name: classNode.className, kind: SYMBOL_CLASS, typeName: classNode.className, classNode: classNode, span: classNode.span}
+			r.declare(classNode.symbol)
+		case INST_INTERFACE:
+			interfaceNode := &instNode.interfaceNode
+			interfaceNode.symbol = &Symbol{name: interfaceNode.name, kind: SYMBOL_INTERFACE, typeName: interfaceNode.name, interfaceNode: interfaceNode, span: interfaceNode.span}
+			r.declare(interfaceNode.symbol)
+		}
+	}
+}
+
+// declare adds a symbol to the current scope, reporting duplicates within the
+// scope and variables that hide another variable of the same method.
+func (r *Resolver) declare(symbol *Symbol) {
+	if previous, ok := r.scope.symbols[symbol.name]; ok {
+		r.diags.error(symbol.span, ERR_REDECLARED, "`%s` is already declared in this scope at %s", symbol.name, previous.span.start)
+		return
+	}
+	if isVariable(symbol) {
+		if previous := r.findVariable(symbol.name); previous != nil {
+			r.diags.warning(symbol.span, WARN_SHADOWED, "`%s` shadows the variable declared at %s", symbol.name, previous.span.start)
+		}
+		symbol.slot = r.locals
+		r.locals++
+	}
+	r.scope.symbols[symbol.name] = symbol
+	delete(r.scope.pending, symbol.name)
+}
+
+func (r *Resolver) findVariable(name string) *Symbol {
+	for scope := r.scope; scope != nil; scope = scope.parent {
+		if symbol, ok := scope.symbols[name]; ok && isVariable(symbol) {
+			return symbol
+		}
+		if scope.frame {
+			break
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) lookupVariable(name string, span Span) *Symbol {
+	if symbol := r.findVariable(name); symbol != nil {
+		return symbol
+	}
+	for scope := r.scope; scope != nil; scope = scope.parent {
+		if scope.pending[name] {
+			r.diags.error(span, ERR_USE_BEFORE_DECLARE, "`%s` is used before it is declared", name)
+			return nil
+		}
+		if scope.frame {
+			break
+		}
+	}
+	if symbol, ok := r.program.symbols[name]; ok && r.scope != r.program {
+		r.diags.error(span, ERR_UNKNOWN_VARIABLE, "methods cannot use the top-level variable `%s` declared at %s", name, symbol.span.start)
+		return nil
+	}
+	r.diags.error(span, ERR_UNKNOWN_VARIABLE, "no such variable `%s`", name)
+	return nil
+}
+
+// lookupMethod finds what a call by name refers to: a method, a builtin, or
+// a class whose constructor is called.
+func (r *Resolver) lookupMethod(name string) *Symbol {
+	for scope := r.scope; scope != nil; scope = scope.parent {
+		if symbol, ok := scope.symbols[name]; ok && (symbol.kind == SYMBOL_METHOD || symbol.kind == SYMBOL_BUILTIN || symbol.kind == SYMBOL_CLASS) {
+			return symbol
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) pushScope(frame bool) {
+	r.scope = newScope(r.scope, frame)
+}
+
+func (r *Resolver) popScope() {
+	r.scope = r.scope.parent
+}
+
+func (r *Resolver) resolveBlock(blockNode *BlockNode) {
+	r.pushScope(false)
+	r.resolveInstructions(blockNode.instructions)
+	r.popScope()
+}
+
+func (r *Resolver) resolveInstructions(instructions []InstNode) {
+	for _, instNode := range instructions {
+		if instNode.instType == INST_ASSIGN {
+			r.scope.pending[instNode.assignNode.identifier] = true
+		}
+	}
+	for i := range instructions {
+		r.resolveInst(&instructions[i])
+	}
+}
+
+func (r *Resolver) resolveInst(instNode *InstNode) {
+	switch instNode.instType {
+	case INST_ASSIGN:
+		assignNode := &instNode.assignNode
+		if assignNode.expr.exprType != "" {
+			r.resolveExpr(&assignNode.expr)
+		}
+		assignNode.symbol = &Symbol{name: assignNode.identifier, kind: SYMBOL_VARIABLE, typeName: assignNode.typeName, span: assignNode.span}
+		r.declare(assignNode.symbol)
+	case INST_REASSIGN:
+		r.resolveExpr(&instNode.reassignNode.expr)
+		r.resolveExpr(&instNode.reassignNode.target)
+	case INST_IF:
+		r.resolveExpr(&instNode.ifNode.condNode)
+		r.resolveBlock(&instNode.ifNode.ifBlockNode)
+		r.resolveBlock(&instNode.ifNode.elseBlockNode)
+	case INST_WHILE:
+		r.resolveExpr(&instNode.whileNode.condNode)
+		r.resolveBlock(&instNode.whileNode.blockNode)
+	case INST_FOR:
+		forNode := &instNode.forNode
+		typeName := ""
+		if forNode.arrayNode.exprType != "" {
+			r.resolveExpr(&forNode.arrayNode)
+		} else {
+			r.resolveExpr(&forNode.startNode)
+			r.resolveExpr(&forNode.endNode)
+			typeName = "int"
+		}
+		r.pushScope(false)
+		forNode.symbol = &Symbol{name: forNode.identifier, kind: SYMBOL_VARIABLE, typeName: typeName, span: forNode.span}
+		r.declare(forNode.symbol)
+		r.resolveBlock(&forNode.blockNode)
+		r.popScope()
+	case INST_PRINT:
+		r.resolveExpr(&instNode.printNode.exprNode)
+	case INST_RETURN:
+		if instNode.returnNode.exprNode.exprType != "" {
+			r.resolveExpr(&instNode.returnNode.exprNode)
+		}
+	case INST_CALL:
+		r.resolveExpr(&instNode.exprNode)
+	case INST_METHOD:
+		if r.scope != r.program {
+			r.diags.error(instNode.span, ERR_NESTED_METHOD, "methods can only be declared at the top level or in a class")
+		}
+		r.resolveMethod(&instNode.methodNode)
+	case INST_CLASS:
+		r.resolveClass(&instNode.classNode)
+	case INST_INTERFACE:
+		r.resolveInterface(&instNode.interfaceNode)
+	}
+}
+
+// resolveMethod resolves a method body in a frame of its own, with the
+// parameters taking the first slots in declaration order. Methods of a class
+// take self before them.
+func (r *Resolver) resolveMethod(methodNode *MethodNode) {
+	scope, locals := r.scope, r.locals
+	r.scope, r.locals = r.global, 0
+	r.pushScope(true)
+	if methodNode.className != "" {
+		methodNode.self = &Symbol{name: "self", kind: SYMBOL_PARAMETER, typeName: methodNode.className, span: methodNode.span}
+		r.declare(methodNode.self)
+	}
+	for i := range methodNode.parameters {
+		paramNode := &methodNode.parameters[i]
+		paramNode.symbol = &Symbol{name: paramNode.name, kind: SYMBOL_PARAMETER, typeName: paramNode.typeName, span: paramNode.span}
+		r.declare(paramNode.symbol)
+	}
+	r.resolveInstructions(methodNode.blockNode.instructions)
+	methodNode.locals = r.locals
+	r.scope, r.locals = scope, locals
+}
+
+func (r *Resolver) resolveClass(classNode *ClassNode) {
+	if r.scope != r.program {
+		r.diags.error(classNode.span, ERR_NESTED_METHOD, "classes can only be declared at the top level")
+	}
+	r.declareClassMembers(classNode)
+
+	// Field initializers run in the constructor, before init, and cannot
+	// see any variables.
+	scope, locals := r.scope, r.locals
+	r.scope = newScope(r.global, true)
+	for i := range classNode.fields {
+		if initializer := classNode.fields[i].initializer; initializer != nil {
+			r.resolveExpr(initializer)
+		}
+	}
+	r.scope, r.locals = scope, locals
+	for i := range classNode.methods {
+		r.resolveMethod(&classNode.methods[i])
+	}
+}
+
+func (r *Resolver) resolveCall(callNode *CallNode) {
+	r.resolveArguments(callNode)
+	callNode.symbol = r.lookupMethod(callNode.methodName)
+	if callNode.symbol != nil {
+		return
+	}
+	if symbol, ok := r.global.symbols[callNode.methodName]; ok && symbol.kind == SYMBOL_INTERFACE {
+		r.diags.error(callNode.span, ERR_UNKNOWN_METHOD, "interface `%s` cannot be instantiated", callNode.methodName)
+		return
+	}
+	r.diags.error(callNode.span, ERR_UNKNOWN_METHOD, "no such method `%s`", callNode.methodName)
+}
+
+// declareClassMembers collects the fields and methods of a class, starting
+// with those it inherits, and lays out its objects and vtable. Base classes
+// are handled first, wherever they are declared.
+func (r *Resolver) declareClassMembers(classNode *ClassNode) {
+	if classNode.members != nil {
+		return
+	}
+	classNode.members = make(map[string]*Symbol)
+	for _, name := range classNode.supertypes {
+		base := r.global.symbols[name]
+		switch {
+		case base != nil && base.kind == SYMBOL_INTERFACE:
+			classNode.interfaces = append(classNode.interfaces, base.interfaceNode)
+		case base == nil || base.kind != SYMBOL_CLASS:
+			r.diags.error(classNode.span, ERR_UNKNOWN_TYPE, "no such class or interface `%s`", name)
+		case classNode.base != nil:
+			r.diags.error(classNode.span, ERR_INVALID_BASE, "class `%s` can only inherit from one class", classNode.className)
+		case r.inheriting[base.classNode] || base.classNode == classNode:
+			r.diags.error(classNode.span, ERR_INVALID_BASE, "class `%s` inherits from itself", classNode.className)
+		default:
+			r.inheriting[classNode] = true
+			r.declareClassMembers(base.classNode)
+			delete(r.inheriting, classNode)
+			classNode.base = base.classNode
+			for name, symbol := range base.classNode.members {
+				classNode.members[name] = symbol
+			}
+			classNode.layout = append(classNode.layout, base.classNode.layout...)
+			classNode.vtable = append(classNode.vtable, base.classNode.vtable...)
+		}
+	}
+
+	declare := func(symbol *Symbol) bool {
+		if previous, ok := classNode.members[symbol.name]; ok && previous.classNode == classNode {
+			r.diags.error(symbol.span, ERR_REDECLARED, "`%s` is already declared in class `%s` at %s", symbol.name, classNode.className, previous.span.start)
+			return false
+		} else if ok && (previous.kind != SYMBOL_METHOD || symbol.kind != SYMBOL_METHOD) {
+			r.diags.error(symbol.span, ERR_REDECLARED, "`%s` is already declared in base class `%s` at %s", symbol.name, previous.classNode.className, previous.span.start)
+			return false
+		}
+		classNode.members[symbol.name] = symbol
+		return true
+	}
+	for i := range classNode.fields {
+		fieldNode := &classNode.fields[i]
+		fieldNode.symbol = &Symbol{name: fieldNode.name, kind: SYMBOL_FIELD, typeName: fieldNode.typeName, slot: len(classNode.layout), classNode: classNode, span: fieldNode.span}
+		if declare(fieldNode.symbol) {
+			classNode.layout = append(classNode.layout, fieldNode.symbol)
+		}
+	}
+	for i := range classNode.methods {
+		methodNode := &classNode.methods[i]
+		methodNode.symbol = &Symbol{name: methodNode.methodName, kind: SYMBOL_METHOD, typeName: methodNode.returnType, methodNode: methodNode, classNode: classNode, span: methodNode.span}
+		overridden := classNode.members[methodNode.methodName]
+		if !declare(methodNode.symbol) {
+			continue
+		}
+		// Constructors are not inherited through the vtable, so each class
+		// is free to choose the parameters of its own init.
+		if overridden != nil && methodNode.methodName != "init" {
+			methodNode.overrides = overridden
+			methodNode.symbol.slot = overridden.slot
+			classNode.vtable[overridden.slot] = methodNode.symbol
+		} else {
+			methodNode.symbol.slot = len(classNode.vtable)
+			classNode.vtable = append(classNode.vtable, methodNode.symbol)
+		}
+	}
+}
+
+// resolveInterface gives the methods of an interface their symbols. The
+// methods have no body, so only their parameters need symbols.
+func (r *Resolver) resolveInterface(interfaceNode *InterfaceNode) {
+	if r.scope != r.program {
+		r.diags.error(interfaceNode.span, ERR_NESTED_METHOD, "interfaces can only be declared at the top level")
+	}
+	interfaceNode.members = make(map[string]*Symbol)
+	for i := range interfaceNode.methods {
+		methodNode := &interfaceNode.methods[i]
+		methodNode.symbol = &Symbol{name: methodNode.methodName, kind: SYMBOL_METHOD, typeName: methodNode.returnType, slot: i, methodNode: methodNode, interfaceNode: interfaceNode, span: methodNode.span}
+		if previous, ok := interfaceNode.members[methodNode.methodName]; ok {
+			r.diags.error(methodNode.span, ERR_REDECLARED, "`%s` is already declared in interface `%s` at %s", methodNode.methodName, interfaceNode.name, previous.span.start)
+			continue
+		}
+		interfaceNode.members[methodNode.methodName] = methodNode.symbol
+		for j := range methodNode.parameters {
+			paramNode := &methodNode.parameters[j]
+			paramNode.symbol = &Symbol{name: paramNode.name, kind: SYMBOL_PARAMETER, typeName: paramNode.typeName, slot: j, span: paramNode.span}
+		}
+	}
+}
+
+// resolveArguments resolves the arguments of a call whose callee is only
+// known once the checker has typed the object it is called on.
+func (r *Resolver) resolveArguments(callNode *CallNode) {
+	for i := range callNode.arguments {
+		r.resolveExpr(&callNode.arguments[i])
+	}
+}
+
+func (r *Resolver) resolveExpr(exprNode *ExprNode) {
+	switch exprNode.exprType {
+	case EXPR_TERM:
+		r.resolveTerm(&exprNode.termNode)
+	case EXPR_NEGATE, EXPR_NOT:
+		r.resolveExpr(exprNode.exprUnaryNode.operand)
+	case EXPR_MEMBER:
+		r.resolveExpr(exprNode.memberNode.object)
+	case EXPR_MEMBER_CALL:
+		r.resolveExpr(exprNode.memberNode.object)
+		r.resolveArguments(&exprNode.memberNode.callNode)
+	case EXPR_INDEX:
+		r.resolveExpr(exprNode.indexNode.array)
+		r.resolveExpr(exprNode.indexNode.index)
+	default:
+		r.resolveExpr(exprNode.exprBinaryNode.lhs)
+		r.resolveExpr(exprNode.exprBinaryNode.rhs)
+	}
+}
+
+func (r *Resolver) resolveTerm(termNode *TermNode) {
+	switch termNode.termType {
+	case TERM_IDENT:
+		termNode.symbol = r.lookupVariable(termNode.value, termNode.span)
+	case TERM_CALL:
+		r.resolveCall(&termNode.callNode)
+	case TERM_ARRAY:
+		for i := range termNode.elements {
+			r.resolveExpr(&termNode.elements[i])
+		}
+	case TERM_MAP:
+		for i := range termNode.elements {
+			r.resolveExpr(&termNode.elements[i])
+			r.resolveExpr(&termNode.values[i])
+		}
+	}
+}
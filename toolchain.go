@@ -0,0 +1,217 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The NASM backend includes these files from the assembly it writes. They
+// are built into yeol so that it works from any directory.
+//
+//go:embed string.inc util.inc array.inc
+var nasmIncludes embed.FS
+
+// Tool is a program of the native toolchain. The variable env, when set,
+// overrides where it is found.
+type Tool struct {
+	name string
+	env  string
+}
+
+var (
+	clangTool = Tool{"clang", "YEOL_CLANG"}
+	llcTool   = Tool{"llc", "YEOL_LLC"}
+	ccTool    = Tool{"cc", "YEOL_CC"}
+	nasmTool  = Tool{"nasm", "YEOL_NASM"}
+	ldTool    = Tool{"ld", "YEOL_LD"}
+)
+
+// find returns the path of the tool, or an empty string if it is missing.
+func (t Tool) find() string {
+	name := t.name
+	if value := os.Getenv(t.env); value != "" {
+		name = value
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func (t Tool) missing(backend Backend) error {
+	return fmt.Errorf("the %s backend needs %s, which was not found; install it or set %s to its path", backend, t.name, t.env)
+}
+
+// Toolchain turns the output of a backend into an object file or an
+// executable. Its intermediate files go to a temporary directory that close
+// removes.
+type Toolchain struct {
+	backend Backend
+	dir     string
+	// name is the name of the source file without its extension. The
+	// intermediate files are named after it, so that the messages of the
+	// tools point at something recognisable.
+	name string
+}
+
+func newToolchain(backend Backend, fileName string) (*Toolchain, error) {
+	dir, err := os.MkdirTemp("", "yeol-")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	return &Toolchain{backend: backend, dir: dir, name: name}, nil
+}
+
+func (t *Toolchain) close() {
+	os.RemoveAll(t.dir)
+}
+
+func (t *Toolchain) temp(extension string) string {
+	return filepath.Join(t.dir, t.name+extension)
+}
+
+// build writes text, the LLVM IR or assembly of a program, and compiles it
+// to an object file or, for EMIT_EXE, an executable at path.
+func (t *Toolchain) build(text string, output Emit, path string) error {
+	switch t.backend {
+	case BACKEND_LLVM:
+		return t.buildLLVM(text, output, path)
+	case BACKEND_NASM:
+		return t.buildNASM(text, output, path)
+	}
+	return fmt.Errorf("the %s backend does not build native code", t.backend)
+}
+
+// buildLLVM uses clang when it is there, and llc and a C compiler
+// otherwise. Compiled programs call the C library, so they are linked by a
+// C compiler either way.
+func (t *Toolchain) buildLLVM(text string, output Emit, path string) error {
+	source := t.temp(".ll")
+	if err := os.WriteFile(source, []byte(text), 0644); err != nil {
+		return err
+	}
+	if clang := clangTool.find(); clang != "" {
+		if output == EMIT_OBJ {
+			return t.runTool(clang, "-c", source, "-o", path)
+		}
+		return t.runTool(clang, source, "-o", path)
+	}
+	llc := llcTool.find()
+	if llc == "" {
+		return fmt.Errorf("the %s backend needs clang, or llc and cc, which were not found; install them or set %s, or %s and %s, to their paths", t.backend, clangTool.env, llcTool.env, ccTool.env)
+	}
+	object := path
+	if output == EMIT_EXE {
+		object = t.temp(".o")
+	}
+	if err := t.runTool(llc, "-filetype=obj", "-relocation-model=pic", source, "-o", object); err != nil {
+		return err
+	}
+	if output == EMIT_OBJ {
+		return nil
+	}
+	cc := ccTool.find()
+	if cc == "" {
+		return ccTool.missing(t.backend)
+	}
+	return t.runTool(cc, object, "-o", path)
+}
+
+// buildNASM assembles with nasm and links with ld. The programs make
+// system calls themselves and need no C library.
+func (t *Toolchain) buildNASM(text string, output Emit, path string) error {
+	nasm := nasmTool.find()
+	if nasm == "" {
+		return nasmTool.missing(t.backend)
+	}
+	ld := ""
+	if output == EMIT_EXE {
+		if ld = ldTool.find(); ld == "" {
+			return ldTool.missing(t.backend)
+		}
+	}
+	source := t.temp(".asm")
+	if err := os.WriteFile(source, []byte(text), 0644); err != nil {
+		return err
+	}
+	entries, err := nasmIncludes.ReadDir(".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		include, err := nasmIncludes.ReadFile(entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(t.dir, entry.Name()), include, 0644); err != nil {
+			return err
+		}
+	}
+	object := path
+	if output == EMIT_EXE {
+		object = t.temp(".o")
+	}
+	if err := t.runTool(nasm, "-f", "elf64", "-i", t.dir+string(filepath.Separator), source, "-o", object); err != nil {
+		return err
+	}
+	if output == EMIT_OBJ {
+		return nil
+	}
+	return t.runTool(ld, object, "-o", path)
+}
+
+// runTool runs a tool, passing its messages through to stderr.
+func (t *Toolchain) runTool(path string, args ...string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// buildNative compiles the output of a backend to an object file or
+// executable at path.
+func buildNative(text string, backend Backend, output Emit, fileName string, path string) error {
+	t, err := newToolchain(backend, fileName)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	return t.build(text, output, path)
+}
+
+// runNative builds an executable in a temporary directory and runs it with
+// the standard streams of yeol. It returns the exit status of the program.
+func runNative(text string, backend Backend, fileName string) (int, error) {
+	t, err := newToolchain(backend, fileName)
+	if err != nil {
+		return exitFailure, err
+	}
+	defer t.close()
+	executable := t.temp("")
+	if err := t.build(text, EMIT_EXE, executable); err != nil {
+		return exitFailure, err
+	}
+	cmd := exec.Command(executable)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return exitFailure, err
+	}
+	return exitSuccess, nil
+}
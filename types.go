@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+type TypeKind string
+
+const (
+	TYPE_INT       TypeKind = "TYPE_INT"
+	TYPE_BOOL      TypeKind = "TYPE_BOOL"
+	TYPE_STRING    TypeKind = "TYPE_STRING"
+	TYPE_VOID      TypeKind = "TYPE_VOID"
+	TYPE_CLASS     TypeKind = "TYPE_CLASS"
+	TYPE_INTERFACE TypeKind = "TYPE_INTERFACE"
+	TYPE_ARRAY     TypeKind = "TYPE_ARRAY"
+	TYPE_MAP       TypeKind = "TYPE_MAP"
+	TYPE_INVALID   TypeKind = "TYPE_INVALID"
+)
+
+// Type is the static type of a value. Class and interface types point at
+// their declaration. Array types have an element type and, unless they can
+// grow, a length. Map types have a key type and hold values of type elem.
+type Type struct {
+	kind          TypeKind
+	name          string
+	classNode     *ClassNode
+	interfaceNode *InterfaceNode
+	elem          *Type
+	length        int
+	key           *Type
+}
+
+// growable is the length of array types whose length is not fixed.
+const growable = -1
+
+// newArrayType returns the type of arrays of elem. Fixed arrays of fixed
+// arrays are named like they are declared, with the outermost length first:
+// `int[2][3]` holds two arrays of three ints.
+func newArrayType(elem *Type, length int) *Type {
+	if length == growable {
+		return &Type{kind: TYPE_ARRAY, name: "[]" + elem.name, elem: elem, length: growable}
+	}
+	base := elem.baseName()
+	name := fmt.Sprintf("%s[%d]%s", base, length, elem.name[len(base):])
+	return &Type{kind: TYPE_ARRAY, name: name, elem: elem, length: length}
+}
+
+func newMapType(key *Type, elem *Type) *Type {
+	return &Type{kind: TYPE_MAP, name: fmt.Sprintf("map[%s]%s", key.name, elem.name), key: key, elem: elem}
+}
+
+// isHashable reports whether values of the type can be map keys.
+func (t *Type) isHashable() bool {
+	switch t.kind {
+	case TYPE_INT, TYPE_BOOL, TYPE_STRING, TYPE_INVALID:
+		return true
+	}
+	return false
+}
+
+// baseName is the name of a type without the lengths of its fixed array
+// dimensions.
+func (t *Type) baseName() string {
+	if t.kind == TYPE_ARRAY && t.length != growable {
+		return t.elem.baseName()
+	}
+	return t.name
+}
+
+var (
+	intType    = &Type{kind: TYPE_INT, name: "int"}
+	boolType   = &Type{kind: TYPE_BOOL, name: "bool"}
+	stringType = &Type{kind: TYPE_STRING, name: "string"}
+	voidType   = &Type{kind: TYPE_VOID, name: "void"}
+	// invalidType is given to expressions that already failed to check, so
+	// that one mistake is not reported again by everything that uses it.
+	invalidType = &Type{kind: TYPE_INVALID, name: "<invalid>"}
+)
+
+var primitiveTypes = map[string]*Type{
+	"int":    intType,
+	"bool":   boolType,
+	"string": stringType,
+}
+
+func (t *Type) String() string {
+	return t.name
+}
+
+// hasZeroValue reports whether a variable of the type can be declared
+// without an initial value. Objects have no zero value.
+func (t *Type) hasZeroValue() bool {
+	switch t.kind {
+	case TYPE_INT, TYPE_BOOL, TYPE_STRING, TYPE_MAP, TYPE_INVALID:
+		return true
+	case TYPE_ARRAY:
+		return t.length == growable || t.elem.hasZeroValue()
+	}
+	return false
+}
+
+// equals reports whether a value of type other can be used where t is
+// expected. The invalid type is compatible with everything, and an object
+// can be used where one of its base classes or an interface it implements
+// is expected.
+func (t *Type) equals(other *Type) bool {
+	if t.kind == TYPE_INVALID || other.kind == TYPE_INVALID {
+		return true
+	}
+	if other.kind == TYPE_CLASS && (t.kind == TYPE_CLASS || t.kind == TYPE_INTERFACE) {
+		for classNode := other.classNode; classNode != nil; classNode = classNode.base {
+			if classNode == t.classNode || slices.Contains(classNode.interfaces, t.interfaceNode) {
+				return true
+			}
+		}
+		return false
+	}
+	if t.kind == TYPE_ARRAY && other.kind == TYPE_ARRAY {
+		// Arrays are shared, so their elements must match exactly.
+		return t.length == other.length && t.elem.equals(other.elem) && other.elem.equals(t.elem)
+	}
+	if t.kind == TYPE_MAP && other.kind == TYPE_MAP {
+		return t.key.equals(other.key) && t.elem.equals(other.elem) && other.elem.equals(t.elem)
+	}
+	return t.kind == other.kind && t.name == other.name
+}